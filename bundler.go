@@ -0,0 +1,268 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/bitrise-io/go-steputils/command/gems"
+	"github.com/bitrise-io/go-steputils/command/rubycommand"
+	"github.com/bitrise-io/go-utils/command"
+	"github.com/bitrise-io/go-utils/fileutil"
+	"github.com/bitrise-io/go-utils/log"
+)
+
+// BundleInstallMode is which gems of the Gemfile are installed.
+type BundleInstallMode string
+
+// BundleInstallModes ...
+const (
+	BundleInstallModeAll           BundleInstallMode = "all"
+	BundleInstallModeCocoapodsOnly BundleInstallMode = "cocoapods_only"
+)
+
+const (
+	defaultBundleInstallJobs  = 20
+	defaultBundleInstallRetry = 5
+	defaultRubygemsSourceURL  = "https://rubygems.org"
+)
+
+// BundleInstallOptions configures bundle install and bundle exec.
+type BundleInstallOptions struct {
+	Mode    BundleInstallMode
+	With    []string
+	Without []string
+	Frozen  bool
+	Jobs    int
+	Retry   int
+	Path    string
+}
+
+// GemfileDependency is a dependency listed in the DEPENDENCIES section of the Gemfile.lock.
+type GemfileDependency struct {
+	Name        string
+	Requirement string
+	// CustomSource is set if the gem comes from a git or path source (marked with ! in the Gemfile.lock).
+	CustomSource bool
+}
+
+// parseBundleGroups parses a space, comma or colon separated list of bundler groups.
+func parseBundleGroups(input string) []string {
+	return strings.FieldsFunc(input, func(r rune) bool {
+		return r == ' ' || r == ',' || r == ':' || r == '\n' || r == '\t'
+	})
+}
+
+// parseBundleInstallCount parses the jobs and retry inputs, returning the default if the input is empty.
+func parseBundleInstallCount(input string, defaultValue int) (int, error) {
+	if input == "" {
+		return defaultValue, nil
+	}
+	count, err := strconv.Atoi(input)
+	if err != nil || count < 0 {
+		return 0, fmt.Errorf("%s should be a non-negative integer", input)
+	}
+	return count, nil
+}
+
+// bundleConfigEnvs returns the bundler configuration environment variables, they apply to both bundle install and bundle exec.
+func bundleConfigEnvs(opts BundleInstallOptions) []string {
+	var envs []string
+	if len(opts.With) > 0 {
+		envs = append(envs, "BUNDLE_WITH="+strings.Join(opts.With, ":"))
+	}
+	if len(opts.Without) > 0 {
+		envs = append(envs, "BUNDLE_WITHOUT="+strings.Join(opts.Without, ":"))
+	}
+	if opts.Frozen {
+		envs = append(envs, "BUNDLE_FROZEN=true")
+	}
+	if opts.Path != "" {
+		envs = append(envs, "BUNDLE_PATH="+opts.Path)
+	}
+	return envs
+}
+
+// bundleInstallCmdSlice returns the bundle install command, the equivalent of gems.BundleInstallCommand with configurable jobs and retry.
+func bundleInstallCmdSlice(bundler gems.Version, opts BundleInstallOptions) []string {
+	slice := []string{"bundle"}
+	if bundler.Found {
+		slice = append(slice, "_"+bundler.Version+"_")
+	}
+	slice = append(slice, "install")
+	if opts.Jobs > 0 {
+		slice = append(slice, "--jobs", strconv.Itoa(opts.Jobs))
+	}
+	if opts.Retry > 0 {
+		slice = append(slice, "--retry", strconv.Itoa(opts.Retry))
+	}
+	return slice
+}
+
+// remote: https://rubygems.org/ (in the GEM section)
+var gemfileLockRemoteExp = regexp.MustCompile(`^  remote: (\S+)$`)
+
+// gemfileLockSectionLines returns the indented lines of the Gemfile.lock section (GEM, PLATFORMS, DEPENDENCIES, ...).
+func gemfileLockSectionLines(content, section string) []string {
+	var lines []string
+	inSection := false
+
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimRight(line, "\r")
+
+		if line == section {
+			inSection = true
+			continue
+		}
+		if !inSection {
+			continue
+		}
+		if !strings.HasPrefix(line, "  ") {
+			break
+		}
+		lines = append(lines, line)
+	}
+
+	return lines
+}
+
+// parseGemfileLockRemote returns the first remote of the GEM section of the Gemfile.lock.
+func parseGemfileLockRemote(content string) string {
+	for _, line := range gemfileLockSectionLines(content, "GEM") {
+		if match := gemfileLockRemoteExp.FindStringSubmatch(line); match != nil {
+			return match[1]
+		}
+	}
+	return ""
+}
+
+// cocoapods (~> 1.11)
+// cocoapods-keys!
+var gemfileDependencyExp = regexp.MustCompile(`^  (\S+?)(!)?(?: \((.+)\))?(!)?$`)
+
+// parseGemfileLockDependencies returns the dependencies listed in the DEPENDENCIES section of the Gemfile.lock.
+func parseGemfileLockDependencies(content string) []GemfileDependency {
+	var dependencies []GemfileDependency
+	for _, line := range gemfileLockSectionLines(content, "DEPENDENCIES") {
+		if match := gemfileDependencyExp.FindStringSubmatch(line); match != nil {
+			dependencies = append(dependencies, GemfileDependency{
+				Name:         match[1],
+				Requirement:  match[3],
+				CustomSource: match[2] != "" || match[4] != "",
+			})
+		}
+	}
+	return dependencies
+}
+
+// cocoapodsOnlyGemfileContent returns a Gemfile containing only cocoapods and the cocoapods plugins of the Gemfile.lock dependencies.
+// Installed with the original Gemfile.lock, bundler keeps the locked versions and drops the rest of the gems.
+func cocoapodsOnlyGemfileContent(dependencies []GemfileDependency, source string) (string, error) {
+	if source == "" {
+		source = defaultRubygemsSourceURL
+	}
+
+	lines := []string{fmt.Sprintf("source %q", source), ""}
+	for _, dependency := range dependencies {
+		if dependency.Name != "cocoapods" && !strings.HasPrefix(dependency.Name, "cocoapods-") {
+			continue
+		}
+		if dependency.CustomSource {
+			return "", fmt.Errorf("%s is installed from a git or path source, which is not supported in %s mode", dependency.Name, BundleInstallModeCocoapodsOnly)
+		}
+
+		line := fmt.Sprintf("gem %q", dependency.Name)
+		for _, requirement := range strings.Split(dependency.Requirement, ",") {
+			if requirement = strings.TrimSpace(requirement); requirement != "" {
+				line += fmt.Sprintf(", %q", requirement)
+			}
+		}
+		lines = append(lines, line)
+	}
+
+	if len(lines) == 2 {
+		return "", fmt.Errorf("no cocoapods dependency found in the Gemfile.lock")
+	}
+
+	return strings.Join(lines, "\n") + "\n", nil
+}
+
+// prepareCocoapodsOnlyGemfile writes the CocoaPods only Gemfile and a copy of the Gemfile.lock into a temporary dir, and returns the Gemfile path.
+// The original Gemfile.lock is not modified, the temporary dir is removed on cleanup.
+func prepareCocoapodsOnlyGemfile(gemfileLockPth string) (string, error) {
+	content, err := fileutil.ReadStringFromFile(gemfileLockPth)
+	if err != nil {
+		return "", err
+	}
+
+	gemfileContent, err := cocoapodsOnlyGemfileContent(parseGemfileLockDependencies(content), parseGemfileLockRemote(content))
+	if err != nil {
+		return "", err
+	}
+
+	tmpDir, err := ioutil.TempDir("", "cocoapods-only-gemfile")
+	if err != nil {
+		return "", err
+	}
+	registerCleanup(func() {
+		if err := os.RemoveAll(tmpDir); err != nil {
+			log.Warnf("Failed to remove %s, error: %s", tmpDir, err)
+		}
+	})
+
+	gemfilePth := filepath.Join(tmpDir, "Gemfile")
+	if err := fileutil.WriteStringToFile(gemfilePth, gemfileContent); err != nil {
+		return "", err
+	}
+	if err := fileutil.WriteStringToFile(gemfilePth+".lock", content); err != nil {
+		return "", err
+	}
+
+	return gemfilePth, nil
+}
+
+// bundleInstallCommand returns the bundle install command.
+// With a custom bundle path the gems are installed into a user owned dir, so the command never runs with sudo.
+func bundleInstallCommand(bundler gems.Version, opts BundleInstallOptions) (*command.Model, error) {
+	slice := bundleInstallCmdSlice(bundler, opts)
+	if opts.Path != "" {
+		return command.NewFromSlice(slice)
+	}
+	return rubycommand.NewFromSlice(slice)
+}
+
+// installBundle runs bundle install with the options, from the CocoaPods only Gemfile in cocoapods_only mode.
+// The bundler config envs are set as process envs, as bundle exec pod needs them too.
+func installBundle(bundler gems.Version, opts BundleInstallOptions, gemfileLockPth, dir string) error {
+	fmt.Println()
+	log.Infof("Installing cocoapods with bundler")
+
+	bundleEnvs := bundleConfigEnvs(opts)
+	if opts.Mode == BundleInstallModeCocoapodsOnly {
+		gemfilePth, err := prepareCocoapodsOnlyGemfile(gemfileLockPth)
+		if err != nil {
+			return fmt.Errorf("failed to prepare the cocoapods only Gemfile, error: %s", err)
+		}
+		log.Printf("Installing only cocoapods and its plugins with Gemfile: %s", gemfilePth)
+		bundleEnvs = append(bundleEnvs, "BUNDLE_GEMFILE="+gemfilePth)
+	}
+
+	for _, env := range bundleEnvs {
+		log.Printf("%s", env)
+		split := strings.SplitN(env, "=", 2)
+		if err := os.Setenv(split[0], split[1]); err != nil {
+			return fmt.Errorf("failed to set env (%s), error: %s", split[0], err)
+		}
+	}
+
+	if err := runGemCommandWithRetry(func() (*command.Model, error) {
+		return bundleInstallCommand(bundler, opts)
+	}, dir); err != nil {
+		return fmt.Errorf("command failed, error: %s", err)
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/bitrise-io/go-steputils/command/gems"
+	"github.com/stretchr/testify/require"
+)
+
+const testBundlerGemfileLock = `GIT
+  remote: https://github.com/orta/cocoapods-keys.git
+  revision: 1a2b3c
+  specs:
+    cocoapods-keys (2.2.1)
+
+GEM
+  remote: https://gems.example.com/
+  specs:
+    cocoapods (1.11.3)
+    danger (8.6.1)
+    fastlane (2.210.1)
+
+PLATFORMS
+  ruby
+
+DEPENDENCIES
+  cocoapods (~> 1.11, >= 1.11.2)
+  cocoapods-binary
+  danger
+  fastlane (= 2.210.1)
+
+BUNDLED WITH
+   2.3.26
+`
+
+func TestParseBundleGroups(t *testing.T) {
+	require.Equal(t, []string{"development", "test", "lint"}, parseBundleGroups("development test,lint"))
+	require.Equal(t, []string{"development", "test"}, parseBundleGroups("development:test"))
+	require.Equal(t, []string{}, parseBundleGroups(" "))
+}
+
+func TestParseBundleInstallCount(t *testing.T) {
+	count, err := parseBundleInstallCount("", defaultBundleInstallJobs)
+	require.NoError(t, err)
+	require.Equal(t, defaultBundleInstallJobs, count)
+
+	count, err = parseBundleInstallCount("4", defaultBundleInstallJobs)
+	require.NoError(t, err)
+	require.Equal(t, 4, count)
+
+	_, err = parseBundleInstallCount("-1", defaultBundleInstallJobs)
+	require.Error(t, err)
+
+	_, err = parseBundleInstallCount("many", defaultBundleInstallJobs)
+	require.Error(t, err)
+}
+
+func TestBundleConfigEnvs(t *testing.T) {
+	require.Nil(t, bundleConfigEnvs(BundleInstallOptions{}))
+
+	require.Equal(t, []string{
+		"BUNDLE_WITH=ci",
+		"BUNDLE_WITHOUT=development:test",
+		"BUNDLE_FROZEN=true",
+		"BUNDLE_PATH=/project/vendor/bundle",
+	}, bundleConfigEnvs(BundleInstallOptions{
+		With:    []string{"ci"},
+		Without: []string{"development", "test"},
+		Frozen:  true,
+		Path:    "/project/vendor/bundle",
+	}))
+}
+
+func TestBundleInstallCmdSlice(t *testing.T) {
+	require.Equal(t, []string{"bundle", "install", "--jobs", "20", "--retry", "5"}, bundleInstallCmdSlice(gems.Version{}, BundleInstallOptions{Jobs: 20, Retry: 5}))
+	require.Equal(t, []string{"bundle", "_2.3.26_", "install"}, bundleInstallCmdSlice(gems.Version{Version: "2.3.26", Found: true}, BundleInstallOptions{}))
+}
+
+func TestParseGemfileLockRemote(t *testing.T) {
+	require.Equal(t, "https://gems.example.com/", parseGemfileLockRemote(testBundlerGemfileLock))
+	require.Equal(t, "", parseGemfileLockRemote("DEPENDENCIES\n  cocoapods\n"))
+}
+
+func TestParseGemfileLockDependencies(t *testing.T) {
+	require.Equal(t, []GemfileDependency{
+		{Name: "cocoapods", Requirement: "~> 1.11, >= 1.11.2"},
+		{Name: "cocoapods-binary"},
+		{Name: "danger"},
+		{Name: "fastlane", Requirement: "= 2.210.1"},
+	}, parseGemfileLockDependencies(testBundlerGemfileLock))
+
+	require.Equal(t, []GemfileDependency{
+		{Name: "cocoapods-keys", CustomSource: true},
+		{Name: "cocoapods-local", Requirement: ">= 0", CustomSource: true},
+	}, parseGemfileLockDependencies("DEPENDENCIES\n  cocoapods-keys!\n  cocoapods-local (>= 0)!\n"))
+}
+
+func TestCocoapodsOnlyGemfileContent(t *testing.T) {
+	t.Log("cocoapods and plugins")
+	{
+		content, err := cocoapodsOnlyGemfileContent(parseGemfileLockDependencies(testBundlerGemfileLock), "https://gems.example.com/")
+		require.NoError(t, err)
+		require.Equal(t, `source "https://gems.example.com/"
+
+gem "cocoapods", "~> 1.11", ">= 1.11.2"
+gem "cocoapods-binary"
+`, content)
+	}
+
+	t.Log("default source")
+	{
+		content, err := cocoapodsOnlyGemfileContent([]GemfileDependency{{Name: "cocoapods"}}, "")
+		require.NoError(t, err)
+		require.Equal(t, "source \"https://rubygems.org\"\n\ngem \"cocoapods\"\n", content)
+	}
+
+	t.Log("plugin from git source")
+	{
+		_, err := cocoapodsOnlyGemfileContent([]GemfileDependency{{Name: "cocoapods"}, {Name: "cocoapods-keys", CustomSource: true}}, "")
+		require.Error(t, err)
+	}
+
+	t.Log("no cocoapods")
+	{
+		_, err := cocoapodsOnlyGemfileContent([]GemfileDependency{{Name: "fastlane"}}, "")
+		require.Error(t, err)
+	}
+}
+
+func TestInstallBundle(t *testing.T) {
+	t.Log("missing gem lockfile in cocoapods_only mode")
+	{
+		err := installBundle(gems.Version{}, BundleInstallOptions{Mode: BundleInstallModeCocoapodsOnly}, "/missing/Gemfile.lock", "/missing")
+		require.Error(t, err)
+	}
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/bitrise-io/go-steputils/command/rubycommand"
+	"github.com/bitrise-io/go-steputils/tools"
+	"github.com/bitrise-io/go-utils/command"
+	"github.com/bitrise-io/go-utils/fileutil"
+	"github.com/bitrise-io/go-utils/log"
+)
+
+const (
+	doctorReportFileName   = "cocoapods_doctor.json"
+	doctorCommandTimeout   = time.Minute
+	doctorCommandNoOutput  = 30 * time.Second
+	doctorOutputLimitBytes = 64 * 1024
+)
+
+// doctorEnvKeys are the environment variables included in the diagnostic report.
+var doctorEnvKeys = []string{
+	"PATH", "LANG", "LC_ALL", "LC_CTYPE",
+	"GEM_HOME", "GEM_PATH", "BUNDLE_GEMFILE", "BUNDLE_PATH", "BUNDLE_WITH", "BUNDLE_WITHOUT", "BUNDLE_FROZEN",
+	"CP_HOME_DIR", "COCOAPODS_DISABLE_STATS", "RBENV_VERSION",
+}
+
+// DoctorInput is what the step knows about the environment, filled in as the step progresses.
+type DoctorInput struct {
+	PodfileDir     string
+	PodfileLockPth string
+	GemfileLockPth string
+	PodCmdSlice    []string
+	PodEnvs        []string
+	// SpecRepoPins are the spec repos checked out at a pinned revision for pod install.
+	// Their checkouts are restored before the report is collected, so the pinned revisions are reported instead of the HEADs.
+	SpecRepoPins []SpecRepoPin
+
+	PodfileLockVersion string
+	GemfileLockVersion string
+	BundlerVersion     string
+	Decision           CocoapodsVersionDecision
+	PodVersion         string
+}
+
+// DoctorSection is the output of a single diagnostic command or lookup.
+type DoctorSection struct {
+	Title   string `json:"title"`
+	Command string `json:"command,omitempty"`
+	Output  string `json:"output"`
+	Error   string `json:"error,omitempty"`
+}
+
+// DoctorSpecRepo is a spec repo with the commit used by pod install: its HEAD, or its pinned revision.
+type DoctorSpecRepo struct {
+	Name           string `json:"name"`
+	URL            string `json:"url"`
+	IsCDN          bool   `json:"is_cdn"`
+	Commit         string `json:"commit,omitempty"`
+	PinnedRevision string `json:"pinned_revision,omitempty"`
+}
+
+// DoctorReport is the diagnostic bundle written by the doctor mode.
+type DoctorReport struct {
+	GeneratedAt     time.Time         `json:"generated_at"`
+	RubyInstallType string            `json:"ruby_install_type"`
+	Versions        map[string]string `json:"versions"`
+	Env             map[string]string `json:"env"`
+	SpecRepos       []DoctorSpecRepo  `json:"spec_repos"`
+	Sections        []DoctorSection   `json:"sections"`
+}
+
+func rubyInstallTypeName(installType rubycommand.InstallType) string {
+	switch installType {
+	case rubycommand.SystemRuby:
+		return "system"
+	case rubycommand.BrewRuby:
+		return "brew"
+	case rubycommand.RVMRuby:
+		return "rvm"
+	case rubycommand.RbenvRuby:
+		return "rbenv"
+	}
+	return "unknown"
+}
+
+// doctorVersions returns the parsed lockfile versions and the CocoaPods version decision, without the empty values.
+func doctorVersions(input DoctorInput) map[string]string {
+	versions := map[string]string{}
+	for key, value := range map[string]string{
+		"podfile_lock_cocoapods": input.PodfileLockVersion,
+		"gemfile_lock_cocoapods": input.GemfileLockVersion,
+		"gemfile_lock_bundler":   input.BundlerVersion,
+		"cocoapods_required":     input.Decision.Version,
+		"cocoapods_source":       input.Decision.Source,
+		"cocoapods_reason":       input.Decision.Reason,
+		"cocoapods_running":      input.PodVersion,
+	} {
+		if value != "" {
+			versions[key] = value
+		}
+	}
+	return versions
+}
+
+// doctorEnv returns the diagnostic environment variables, with the secrets redacted.
+func doctorEnv(getenv func(string) string) map[string]string {
+	env := map[string]string{}
+	for _, key := range doctorEnvKeys {
+		if value := getenv(key); value != "" {
+			env[key] = redactSecrets(value)
+		}
+	}
+	return env
+}
+
+// truncateDoctorOutput keeps the end of a long output, which usually contains the error.
+func truncateDoctorOutput(output string, limit int) string {
+	if len(output) <= limit {
+		return output
+	}
+	return fmt.Sprintf("... (%d bytes truncated)\n%s", len(output)-limit, output[len(output)-limit:])
+}
+
+// runDoctorCommand runs a diagnostic command with a short timeout, and returns its redacted output.
+func runDoctorCommand(title string, slice []string, dir string, envs []string) DoctorSection {
+	section := DoctorSection{Title: title}
+
+	cmd, err := command.NewFromSlice(slice)
+	if err != nil {
+		section.Error = err.Error()
+		return section
+	}
+	section.Command = redactSecrets(cmd.PrintableCommandArgs())
+
+	var output bytes.Buffer
+	cmd.SetStdout(&output).SetStderr(&output)
+	cmd.SetDir(dir)
+	cmd.AppendEnvs(envs...)
+
+	err = runCommandWithTimeouts(cmd, CommandTimeouts{Timeout: doctorCommandTimeout, InactivityTimeout: doctorCommandNoOutput})
+	section.Output = truncateDoctorOutput(redactSecrets(strings.TrimSpace(output.String())), doctorOutputLimitBytes)
+	if err != nil {
+		section.Error = redactSecrets(err.Error())
+	}
+	return section
+}
+
+// doctorSpecRepos lists the local spec repos with the HEAD commit of the git ones, or the pinned commit of the pinned ones.
+func doctorSpecRepos(pins []SpecRepoPin) ([]DoctorSpecRepo, error) {
+	localRepos, err := listLocalSpecRepos()
+	if err != nil {
+		return nil, err
+	}
+
+	var repos []DoctorSpecRepo
+	for _, localRepo := range localRepos {
+		repo := DoctorSpecRepo{Name: localRepo.Name, URL: redactSecrets(localRepo.URL), IsCDN: localRepo.IsCDN}
+		if !localRepo.IsCDN {
+			revision := "HEAD"
+			for _, pin := range pins {
+				if pin.Name == localRepo.Name {
+					repo.PinnedRevision = pin.Revision
+					revision = pin.Revision + "^{commit}"
+				}
+			}
+
+			commit, err := command.New("git", "rev-parse", revision).SetDir(filepath.Join(specReposDir(), localRepo.Name)).RunAndReturnTrimmedCombinedOutput()
+			if err != nil {
+				log.Warnf("Failed to get the %s commit of spec repo (%s), error: %s", revision, localRepo.Name, err)
+			} else {
+				repo.Commit = commit
+			}
+		}
+		repos = append(repos, repo)
+	}
+	return repos, nil
+}
+
+// collectDoctorReport runs the diagnostic commands and collects the environment.
+func collectDoctorReport(input DoctorInput) DoctorReport {
+	report := DoctorReport{
+		GeneratedAt:     time.Now(),
+		RubyInstallType: rubyInstallTypeName(rubycommand.RubyInstallType()),
+		Versions:        doctorVersions(input),
+		Env:             doctorEnv(os.Getenv),
+	}
+
+	podCmdSlice := input.PodCmdSlice
+	if len(podCmdSlice) == 0 {
+		podCmdSlice = []string{"pod"}
+	}
+
+	report.Sections = append(report.Sections,
+		runDoctorCommand("Executables", []string{"which", "-a", "ruby", "pod", "bundle", "gem"}, input.PodfileDir, nil),
+		runDoctorCommand("Gem environment", []string{"gem", "env"}, input.PodfileDir, nil),
+		runDoctorCommand("Installed CocoaPods gems", []string{"gem", "list", "cocoapods"}, input.PodfileDir, nil),
+	)
+	if input.GemfileLockPth != "" {
+		report.Sections = append(report.Sections, runDoctorCommand("Bundle environment", []string{"bundle", "env"}, filepath.Dir(input.GemfileLockPth), nil))
+	}
+	report.Sections = append(report.Sections, runDoctorCommand("CocoaPods environment", append(append([]string{}, podCmdSlice...), "env"), input.PodfileDir, input.PodEnvs))
+
+	repos, err := doctorSpecRepos(input.SpecRepoPins)
+	if err != nil {
+		report.Sections = append(report.Sections, DoctorSection{Title: "Spec repos", Error: err.Error()})
+	}
+	report.SpecRepos = repos
+
+	return report
+}
+
+// writeDoctorReport writes the report as JSON into the deploy dir.
+func writeDoctorReport(report DoctorReport, deployDir string) (string, error) {
+	content, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return "", err
+	}
+
+	pth := filepath.Join(deployDir, doctorReportFileName)
+	if err := fileutil.WriteBytesToFile(pth, content); err != nil {
+		return "", err
+	}
+	return pth, nil
+}
+
+// setupDoctor returns the doctor input to fill in as the step progresses. If enabled, the report is collected from it on exit,
+// whether the step succeeds or fails.
+func setupDoctor(enabled bool, podfileDir, deployDir string) *DoctorInput {
+	input := &DoctorInput{PodfileDir: podfileDir}
+	if enabled {
+		registerCleanup(func() {
+			runDoctor(*input, deployDir)
+		})
+	}
+	return input
+}
+
+// runDoctor collects the diagnostic report and exports its path.
+// It is skipped after an interrupt, as no new command can be started then.
+func runDoctor(input DoctorInput, deployDir string) {
+	if isInterrupted() {
+		return
+	}
+
+	fmt.Println()
+	log.Infof("Collecting CocoaPods and Ruby diagnostics")
+
+	pth, err := writeDoctorReport(collectDoctorReport(input), deployDir)
+	if err != nil {
+		log.Warnf("Failed to write diagnostics, error: %s", err)
+		return
+	}
+	log.Donef("Diagnostics written to: %s", pth)
+
+	if err := tools.ExportEnvironmentWithEnvman("COCOAPODS_DOCTOR_REPORT_PATH", pth); err != nil {
+		log.Warnf("Failed to export COCOAPODS_DOCTOR_REPORT_PATH, error: %s", err)
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bitrise-io/go-steputils/command/rubycommand"
+	"github.com/bitrise-io/go-utils/command"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRubyInstallTypeName(t *testing.T) {
+	require.Equal(t, "rbenv", rubyInstallTypeName(rubycommand.RbenvRuby))
+	require.Equal(t, "system", rubyInstallTypeName(rubycommand.SystemRuby))
+	require.Equal(t, "unknown", rubyInstallTypeName(rubycommand.Unkown))
+}
+
+func TestDoctorVersions(t *testing.T) {
+	require.Equal(t, map[string]string{
+		"podfile_lock_cocoapods": "1.11.3",
+		"cocoapods_required":     "1.11.3",
+		"cocoapods_source":       CocoapodsVersionSourcePodfileLock,
+		"cocoapods_reason":       "no Gemfile.lock with cocoapods found",
+	}, doctorVersions(DoctorInput{
+		PodfileLockVersion: "1.11.3",
+		Decision:           CocoapodsVersionDecision{Version: "1.11.3", Source: CocoapodsVersionSourcePodfileLock, Reason: "no Gemfile.lock with cocoapods found"},
+	}))
+}
+
+func TestDoctorEnv(t *testing.T) {
+	secretValues = nil
+	defer func() { secretValues = nil }()
+	registerSecret("s3cr3t")
+
+	env := doctorEnv(func(key string) string {
+		return map[string]string{
+			"PATH":           "/usr/bin:/bin",
+			"LANG":           "en_US.UTF-8",
+			"BUNDLE_GEMFILE": "/tmp/s3cr3t/Gemfile",
+			"GIT_PASSWORD":   "s3cr3t",
+		}[key]
+	})
+
+	require.Equal(t, map[string]string{
+		"PATH":           "/usr/bin:/bin",
+		"LANG":           "en_US.UTF-8",
+		"BUNDLE_GEMFILE": "/tmp/" + redactedValue + "/Gemfile",
+	}, env)
+}
+
+func TestTruncateDoctorOutput(t *testing.T) {
+	require.Equal(t, "short", truncateDoctorOutput("short", 10))
+	require.Equal(t, "... (5 bytes truncated)\n6789012345", truncateDoctorOutput("123456789012345", 10))
+}
+
+func TestRunDoctorCommand(t *testing.T) {
+	secretValues = nil
+	defer func() { secretValues = nil }()
+	registerSecret("s3cr3t")
+
+	section := runDoctorCommand("Echo", []string{"echo", "token: s3cr3t"}, "", nil)
+	require.Equal(t, "Echo", section.Title)
+	require.Equal(t, "token: "+redactedValue, section.Output)
+	require.Empty(t, section.Error)
+	require.False(t, strings.Contains(section.Command, "s3cr3t"))
+
+	section = runDoctorCommand("Fail", []string{"false"}, "", nil)
+	require.NotEmpty(t, section.Error)
+}
+
+func TestSetupDoctor(t *testing.T) {
+	cleanupCount := func() int {
+		cleanupFuncsMu.Lock()
+		defer cleanupFuncsMu.Unlock()
+		return len(cleanupFuncs)
+	}
+	count := cleanupCount()
+
+	t.Log("disabled")
+	{
+		input := setupDoctor(false, "/project", "/deploy")
+		require.Equal(t, "/project", input.PodfileDir)
+		require.Equal(t, count, cleanupCount())
+	}
+
+	t.Log("enabled")
+	{
+		setupDoctor(true, "/project", "/deploy")
+		require.Equal(t, count+1, cleanupCount())
+
+		cleanupFuncsMu.Lock()
+		cleanupFuncs = cleanupFuncs[:count]
+		cleanupFuncsMu.Unlock()
+	}
+}
+
+func TestDoctorSpecRepos(t *testing.T) {
+	reposDir, err := ioutil.TempDir("", "repos")
+	require.NoError(t, err)
+	defer func() { require.NoError(t, os.RemoveAll(reposDir)) }()
+
+	original, isSet := os.LookupEnv("CP_REPOS_DIR")
+	require.NoError(t, os.Setenv("CP_REPOS_DIR", reposDir))
+	defer func() {
+		if isSet {
+			require.NoError(t, os.Setenv("CP_REPOS_DIR", original))
+		} else {
+			require.NoError(t, os.Unsetenv("CP_REPOS_DIR"))
+		}
+	}()
+
+	repoDir := filepath.Join(reposDir, "my-specs")
+	require.NoError(t, os.MkdirAll(repoDir, 0755))
+	git := func(args ...string) string {
+		out, err := command.New("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...).SetDir(repoDir).RunAndReturnTrimmedCombinedOutput()
+		require.NoError(t, err, out)
+		return out
+	}
+	git("init", "--quiet", "--initial-branch", "master")
+	git("remote", "add", "origin", "https://github.com/my/specs.git")
+	git("commit", "--quiet", "--allow-empty", "-m", "first")
+	git("tag", "v1")
+	first := git("rev-parse", "HEAD")
+	git("commit", "--quiet", "--allow-empty", "-m", "second")
+	second := git("rev-parse", "HEAD")
+
+	t.Log("HEAD commit")
+	{
+		repos, err := doctorSpecRepos(nil)
+		require.NoError(t, err)
+		require.Equal(t, []DoctorSpecRepo{{Name: "my-specs", URL: "https://github.com/my/specs.git", Commit: second}}, repos)
+	}
+
+	t.Log("pinned commit, after the checkout is restored")
+	{
+		repos, err := doctorSpecRepos([]SpecRepoPin{{Name: "my-specs", Revision: "v1"}})
+		require.NoError(t, err)
+		require.Equal(t, []DoctorSpecRepo{{Name: "my-specs", URL: "https://github.com/my/specs.git", Commit: first, PinnedRevision: "v1"}}, repos)
+	}
+}
+
+func TestWriteDoctorReport(t *testing.T) {
+	deployDir, err := ioutil.TempDir("", "doctor")
+	require.NoError(t, err)
+	defer func() { require.NoError(t, os.RemoveAll(deployDir)) }()
+
+	report := DoctorReport{
+		RubyInstallType: "rbenv",
+		Versions:        map[string]string{"cocoapods_running": "1.11.3"},
+		Sections:        []DoctorSection{{Title: "Gem environment", Command: "gem env", Output: "RUBYGEMS VERSION: 3.1.6"}},
+	}
+
+	pth, err := writeDoctorReport(report, deployDir)
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(deployDir, doctorReportFileName), pth)
+
+	content, err := ioutil.ReadFile(pth)
+	require.NoError(t, err)
+
+	var written DoctorReport
+	require.NoError(t, json.Unmarshal(content, &written))
+	require.Equal(t, report.Versions, written.Versions)
+	require.Equal(t, report.Sections, written.Sections)
+}
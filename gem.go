@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/bitrise-io/go-steputils/command/gems"
+	"github.com/bitrise-io/go-utils/command"
+	"github.com/bitrise-io/go-utils/log"
+)
+
+const (
+	gemCommandRetryCount       = 3
+	gemCommandRetryInitialWait = 5 * time.Second
+)
+
+// GemSource is a RubyGems mirror used instead of rubygems.org.
+type GemSource struct {
+	URL      string
+	Username string
+	Password string
+}
+
+// IsSet returns true if a mirror is configured.
+func (source GemSource) IsSet() bool {
+	return source.URL != ""
+}
+
+// URLWithCredentials returns the mirror url with the credentials embedded, as expected by gem install --source.
+func (source GemSource) URLWithCredentials() (string, error) {
+	u, err := url.Parse(source.URL)
+	if err != nil {
+		return "", err
+	}
+	if source.Username != "" {
+		u.User = url.UserPassword(source.Username, source.Password)
+	}
+	return u.String(), nil
+}
+
+// bundlerCredentialEnvKey returns the env key bundler reads the credentials of the given host from,
+// for example: BUNDLE_GEMS__MY___MIRROR__COM for gems.my-mirror.com.
+func bundlerCredentialEnvKey(host string) string {
+	key := strings.ToUpper(host)
+	key = strings.Replace(key, ".", "__", -1)
+	key = strings.Replace(key, "-", "___", -1)
+	return "BUNDLE_" + key
+}
+
+// bundlerMirrorEnvs returns the envs configuring bundler to use the mirror instead of rubygems.org.
+func bundlerMirrorEnvs(source GemSource) ([]string, error) {
+	u, err := url.Parse(source.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	envs := []string{"BUNDLE_MIRROR__RUBYGEMS__ORG=" + source.URL}
+	if source.Username != "" {
+		envs = append(envs, fmt.Sprintf("%s=%s:%s", bundlerCredentialEnvKey(u.Host), source.Username, source.Password))
+	}
+	return envs, nil
+}
+
+// gemSourceArgs returns the gem install arguments replacing rubygems.org with the mirror.
+func gemSourceArgs(source GemSource) ([]string, error) {
+	if !source.IsSet() {
+		return nil, nil
+	}
+
+	u, err := source.URLWithCredentials()
+	if err != nil {
+		return nil, err
+	}
+	return []string{"--clear-sources", "--source", u}, nil
+}
+
+// gemInstallCmdSlice returns the gem install command for the given gem, the equivalent of rubycommand.GemInstall, with mirror support.
+func gemInstallCmdSlice(gem, version string, enablePrerelease bool, source GemSource) ([]string, error) {
+	slice := []string{"gem", "install", gem, "--no-document"}
+	if enablePrerelease {
+		slice = append(slice, "--prerelease")
+	}
+	if version != "" {
+		slice = append(slice, "-v", version)
+	}
+
+	sourceArgs, err := gemSourceArgs(source)
+	if err != nil {
+		return nil, err
+	}
+	return append(slice, sourceArgs...), nil
+}
+
+// installBundlerCommand returns a command to install a specific bundler version, the equivalent of gems.InstallBundlerCommand, with mirror support.
+func installBundlerCommand(gemfileLockVersion gems.Version, source GemSource) (*command.Model, error) {
+	args := []string{"install", "bundler", "--force", "--no-document"}
+	if gemfileLockVersion.Found {
+		args = append(args, []string{"--version", gemfileLockVersion.Version}...)
+	}
+
+	sourceArgs, err := gemSourceArgs(source)
+	if err != nil {
+		return nil, err
+	}
+	args = append(args, sourceArgs...)
+
+	return command.New("gem", args...), nil
+}
+
+var transientNetworkErrorExp = regexp.MustCompile(`(?i)(Gem::RemoteFetcher::FetchError|Gem::RemoteFetcher::UnknownHostError|Bundler::HTTPError|Could not fetch specs from|Could not reach host|Unable to download data from|Errno::ECONNRESET|Errno::ECONNREFUSED|Errno::ETIMEDOUT|Net::OpenTimeout|Net::ReadTimeout|SocketError|Too many connection resets|Connection reset by peer|execution expired|SSL_connect)`)
+
+// isTransientNetworkError returns true if the output of a gem or bundle command shows a network failure worth to retry.
+func isTransientNetworkError(output string) bool {
+	return transientNetworkErrorExp.MatchString(output)
+}
+
+// runGemCommandWithRetry runs the command created by createCmd, and retries it with an exponential backoff on transient network failures and timeouts.
+func runGemCommandWithRetry(createCmd func() (*command.Model, error), dir string) error {
+	wait := gemCommandRetryInitialWait
+	for attempt := 1; ; attempt++ {
+		cmd, err := createCmd()
+		if err != nil {
+			return fmt.Errorf("failed to create command model, error: %s", err)
+		}
+
+		var output bytes.Buffer
+		cmd.SetStdout(io.MultiWriter(os.Stdout, &output)).SetStderr(io.MultiWriter(os.Stderr, &output))
+		cmd.SetDir(dir)
+
+		log.Donef("$ %s", redactSecrets(cmd.PrintableCommandArgs()))
+		fmt.Println()
+
+		err = runCommand(cmd)
+		if err == nil {
+			return nil
+		}
+
+		_, isTimeout := err.(*CommandTimeoutError)
+		if attempt >= gemCommandRetryCount || !(isTimeout || isTransientNetworkError(output.String())) {
+			return err
+		}
+
+		log.Warnf("Command failed with a network error or timed out (attempt %d/%d), retrying in %s ...", attempt, gemCommandRetryCount, wait)
+		time.Sleep(wait)
+		wait *= 2
+	}
+}
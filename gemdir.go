@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+)
+
+// isolatedGemDir returns the gem dir of the given CocoaPods version, for example: <baseDir>/2.7.4/cocoapods-1.10.1.
+func isolatedGemDir(baseDir, rubyVersion, cocoapodsVersion string) string {
+	return filepath.Join(baseDir, rubyVersion, "cocoapods-"+cocoapodsVersion)
+}
+
+// isolatedGemEnvs returns the environment variables restricting RubyGems to the gem dir.
+func isolatedGemEnvs(gemDir string) []string {
+	return []string{
+		"GEM_HOME=" + gemDir,
+		"GEM_PATH=" + gemDir,
+	}
+}
+
+// isolatedPodCmdSlice returns the pod executable of the gem dir.
+func isolatedPodCmdSlice(gemDir string) []string {
+	return []string{filepath.Join(gemDir, "bin", "pod")}
+}
+
+// isGemInstalledInGemDir checks if the given gem version's specification exists in the gem dir.
+func isGemInstalledInGemDir(gemDir, gem, version string) bool {
+	return isPathExists(filepath.Join(gemDir, "specifications", fmt.Sprintf("%s-%s.gemspec", gem, version)))
+}
+
+// isolatedGemInstallCmdSlice returns the gem install command installing the gem and its dependencies into the gem dir.
+// The command does not need sudo, as the gem dir is owned by the current user.
+func isolatedGemInstallCmdSlice(gemDir, gem, version string, enablePrerelease bool, source GemSource) ([]string, error) {
+	slice, err := gemInstallCmdSlice(gem, version, enablePrerelease, source)
+	if err != nil {
+		return nil, err
+	}
+	return append(slice, "--install-dir", gemDir, "--bindir", filepath.Join(gemDir, "bin")), nil
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsolatedGemDir(t *testing.T) {
+	require.Equal(t, "/cache/gems/2.7.4/cocoapods-1.10.1", isolatedGemDir("/cache/gems", "2.7.4", "1.10.1"))
+	require.Equal(t, []string{"/cache/gems/2.7.4/cocoapods-1.10.1/bin/pod"}, isolatedPodCmdSlice("/cache/gems/2.7.4/cocoapods-1.10.1"))
+	require.Equal(t, []string{"GEM_HOME=/gems", "GEM_PATH=/gems"}, isolatedGemEnvs("/gems"))
+}
+
+func TestIsGemInstalledInGemDir(t *testing.T) {
+	gemDir, err := ioutil.TempDir("", "gems")
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, os.RemoveAll(gemDir))
+	}()
+
+	require.False(t, isGemInstalledInGemDir(gemDir, "cocoapods", "1.10.1"))
+
+	require.NoError(t, os.MkdirAll(filepath.Join(gemDir, "specifications"), 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(gemDir, "specifications", "cocoapods-1.10.1.gemspec"), []byte(""), 0644))
+
+	require.True(t, isGemInstalledInGemDir(gemDir, "cocoapods", "1.10.1"))
+	require.False(t, isGemInstalledInGemDir(gemDir, "cocoapods", "1.10.0"))
+	require.False(t, isGemInstalledInGemDir(gemDir, "cocoapods", "1.10"))
+}
+
+func TestIsolatedGemInstallCmdSlice(t *testing.T) {
+	t.Log("without mirror")
+	{
+		slice, err := isolatedGemInstallCmdSlice("/gems", "cocoapods", "1.10.1", false, GemSource{})
+		require.NoError(t, err)
+		require.Equal(t, []string{"gem", "install", "cocoapods", "--no-document", "-v", "1.10.1", "--install-dir", "/gems", "--bindir", "/gems/bin"}, slice)
+	}
+
+	t.Log("prerelease")
+	{
+		slice, err := isolatedGemInstallCmdSlice("/gems", "cocoapods", "1.12.0.beta.1", isPrereleaseVersion("1.12.0.beta.1"), GemSource{})
+		require.NoError(t, err)
+		require.Equal(t, []string{"gem", "install", "cocoapods", "--no-document", "--prerelease", "-v", "1.12.0.beta.1", "--install-dir", "/gems", "--bindir", "/gems/bin"}, slice)
+	}
+
+	t.Log("with mirror")
+	{
+		slice, err := isolatedGemInstallCmdSlice("/gems", "cocoapods", "1.10.1", false, GemSource{URL: "https://gems.example.com"})
+		require.NoError(t, err)
+		require.Equal(t, []string{"gem", "install", "cocoapods", "--no-document", "-v", "1.10.1", "--clear-sources", "--source", "https://gems.example.com", "--install-dir", "/gems", "--bindir", "/gems/bin"}, slice)
+	}
+}
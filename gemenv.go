@@ -0,0 +1,294 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"syscall"
+
+	"github.com/bitrise-io/go-steputils/command/rubycommand"
+	"github.com/bitrise-io/go-utils/command"
+	"github.com/bitrise-io/go-utils/log"
+	"github.com/bitrise-io/go-utils/sliceutil"
+)
+
+// GemEnvironment is the parsed output of `gem env`.
+type GemEnvironment struct {
+	RubygemsVersion     string
+	RubyVersion         string
+	RubyPlatform        string
+	InstallationDir     string
+	UserInstallationDir string
+	ExecutableDir       string
+	Platforms           []string
+	GemPaths            []string
+
+	IsInstallationDirWritable bool
+}
+
+// GemInstallMode is how gems are installed.
+type GemInstallMode string
+
+// GemInstallModes ...
+const (
+	GemInstallModeDefault     GemInstallMode = "default"
+	GemInstallModeSudo        GemInstallMode = "sudo"
+	GemInstallModeUserInstall GemInstallMode = "user-install"
+	GemInstallModeIsolated    GemInstallMode = "isolated"
+)
+
+// - RUBY VERSION: 2.7.4 (2021-07-07 patchlevel 191) [x86_64-darwin20]
+var gemEnvRubyVersionExp = regexp.MustCompile(`^(\S+)(?: .*)?\[(.+)\]$`)
+
+// parseGemEnvironment parses the `gem env` output, the ` - KEY: value` lines and the ` - KEY:` lists.
+func parseGemEnvironment(output string) GemEnvironment {
+	var env GemEnvironment
+	var list *[]string
+
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, "- ") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "- ")
+
+		indented := strings.HasPrefix(scanner.Text(), "     ")
+		if indented {
+			if list != nil {
+				*list = append(*list, line)
+			}
+			continue
+		}
+		list = nil
+
+		split := strings.SplitN(line, ":", 2)
+		if len(split) != 2 {
+			continue
+		}
+		key, value := strings.TrimSpace(split[0]), strings.TrimSpace(split[1])
+
+		switch key {
+		case "RUBYGEMS VERSION":
+			env.RubygemsVersion = value
+		case "RUBY VERSION":
+			if match := gemEnvRubyVersionExp.FindStringSubmatch(value); match != nil {
+				env.RubyVersion = match[1]
+				env.RubyPlatform = match[2]
+			} else if fields := strings.Fields(value); len(fields) > 0 {
+				env.RubyVersion = fields[0]
+			}
+		case "INSTALLATION DIRECTORY":
+			env.InstallationDir = value
+		case "USER INSTALLATION DIRECTORY":
+			env.UserInstallationDir = value
+		case "EXECUTABLE DIRECTORY":
+			env.ExecutableDir = value
+		case "RUBYGEMS PLATFORMS":
+			list = &env.Platforms
+		case "GEM PATHS":
+			list = &env.GemPaths
+		}
+	}
+
+	return env
+}
+
+// isDirWritable checks if the dir, or if it does not exist its nearest existing parent, is writable by the current user.
+func isDirWritable(dir string) bool {
+	for {
+		if _, err := os.Stat(dir); err == nil {
+			const wOK = 2
+			return syscall.Access(dir, wOK) == nil
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return false
+		}
+		dir = parent
+	}
+}
+
+// gemEnvironment runs `gem env` and checks if the gem installation dir is writable.
+func gemEnvironment() (GemEnvironment, error) {
+	out, err := command.New("gem", "env").RunAndReturnTrimmedCombinedOutput()
+	if err != nil {
+		return GemEnvironment{}, fmt.Errorf("%s: %s", out, err)
+	}
+
+	env := parseGemEnvironment(out)
+	if env.InstallationDir == "" {
+		return GemEnvironment{}, fmt.Errorf("no installation directory found in gem env output: %s", out)
+	}
+	env.IsInstallationDirWritable = isDirWritable(env.InstallationDir)
+
+	return env, nil
+}
+
+// gemInstallMode decides how to install a gem: into the isolated gem dir if it is set,
+// into the installation dir if it is writable, otherwise into the user's gem dir, or with sudo as the last resort.
+func gemInstallMode(env GemEnvironment, isolatedBaseDir string) GemInstallMode {
+	switch {
+	case isolatedBaseDir != "":
+		return GemInstallModeIsolated
+	case env.IsInstallationDirWritable:
+		return GemInstallModeDefault
+	case env.UserInstallationDir != "" && isDirWritable(env.UserInstallationDir):
+		return GemInstallModeUserInstall
+	default:
+		return GemInstallModeSudo
+	}
+}
+
+// gemInstallModeCmdSlice applies the install mode to a gem install command.
+func gemInstallModeCmdSlice(mode GemInstallMode, slice []string) []string {
+	switch mode {
+	case GemInstallModeSudo:
+		return append([]string{"sudo"}, slice...)
+	case GemInstallModeUserInstall:
+		return append(append([]string{}, slice...), "--user-install")
+	}
+	return slice
+}
+
+// minitest (5.10.1, 5.9.1, default: 5.8.3)
+// nokogiri (1.11.1 x86_64-darwin, 1.10.10)
+var gemListLineExp = regexp.MustCompile(`^(\S+) \((.*)\)$`)
+
+// parseGemListVersions returns the versions of the gem listed in the `gem list` output.
+func parseGemListVersions(gemListOutput, gem string) []string {
+	var versions []string
+	for _, line := range strings.Split(gemListOutput, "\n") {
+		match := gemListLineExp.FindStringSubmatch(strings.TrimSpace(line))
+		if match == nil || match[1] != gem {
+			continue
+		}
+
+		for _, installed := range strings.Split(match[2], ",") {
+			fields := strings.Fields(strings.TrimPrefix(strings.TrimSpace(installed), "default:"))
+			if len(fields) > 0 {
+				versions = append(versions, fields[0])
+			}
+		}
+	}
+	return versions
+}
+
+// isGemVersionInstalled checks the `gem list` output for the exact version of the gem.
+func isGemVersionInstalled(gemListOutput, gem, version string) bool {
+	return sliceutil.IsStringInSlice(version, parseGemListVersions(gemListOutput, gem))
+}
+
+// isGemInstalled checks if the exact version of the gem is installed in one of the gem paths.
+func isGemInstalled(gem, version string) (bool, error) {
+	out, err := command.New("gem", "list", "--exact", gem).RunAndReturnTrimmedCombinedOutput()
+	if err != nil {
+		return false, fmt.Errorf("%s: %s", out, err)
+	}
+	return isGemVersionInstalled(out, gem, version), nil
+}
+
+// installCocoapodsGem installs the cocoapods version with the install mode, unless it is installed already,
+// and returns the installed version and the isolated gem dir (empty if the mode is not isolated).
+// If the version can not be installed (it might be yanked, or not installable with the current ruby),
+// the nearest patch release is installed instead, unless the fallback is none.
+func installCocoapodsGem(version string, env GemEnvironment, mode GemInstallMode, isolatedBaseDir string, fallback VersionFallback, source GemSource, dir string) (string, string, error) {
+	fallbackVersion := ""
+	for {
+		gemDir := ""
+		installed := false
+		if mode == GemInstallModeIsolated {
+			gemDir = isolatedGemDir(isolatedBaseDir, env.RubyVersion, version)
+			log.Printf("Checking cocoapods %s gem in: %s", version, gemDir)
+
+			installed = isGemInstalledInGemDir(gemDir, "cocoapods", version)
+		} else {
+			log.Printf("Checking cocoapods %s gem", version)
+
+			var err error
+			if installed, err = isGemInstalled("cocoapods", version); err != nil {
+				return "", "", fmt.Errorf("failed to check if cocoapods %s installed, error: %s", version, err)
+			}
+		}
+
+		if installed {
+			log.Printf("Installed")
+			return version, gemDir, nil
+		}
+
+		log.Printf("Installing")
+
+		var gemInstallCmd []string
+		var err error
+		if mode == GemInstallModeIsolated {
+			gemInstallCmd, err = isolatedGemInstallCmdSlice(gemDir, "cocoapods", version, isPrereleaseVersion(version), source)
+		} else {
+			gemInstallCmd, err = gemInstallCmdSlice("cocoapods", version, isPrereleaseVersion(version), source)
+			gemInstallCmd = gemInstallModeCmdSlice(mode, gemInstallCmd)
+		}
+		if err != nil {
+			return "", "", fmt.Errorf("failed to create command model, error: %s", err)
+		}
+
+		installErr := runGemCommandWithRetry(func() (*command.Model, error) {
+			cmd, err := command.NewFromSlice(gemInstallCmd)
+			if err != nil {
+				return nil, err
+			}
+			if mode == GemInstallModeIsolated {
+				cmd.AppendEnvs(isolatedGemEnvs(gemDir)...)
+			}
+			return cmd, nil
+		}, dir)
+		if installErr == nil {
+			if mode != GemInstallModeIsolated && rubycommand.RubyInstallType() == rubycommand.RbenvRuby {
+				cmd := command.New("rbenv", "rehash")
+				cmd.SetDir(dir)
+
+				log.Donef("$ %s", redactSecrets(cmd.PrintableCommandArgs()))
+				if err := runCommand(cmd); err != nil {
+					return "", "", fmt.Errorf("command failed, error: %s", err)
+				}
+			}
+			return version, gemDir, nil
+		}
+
+		if fallback == VersionFallbackNone || fallbackVersion != "" {
+			return "", "", fmt.Errorf("command failed, error: %s", installErr)
+		}
+
+		log.Warnf("Failed to install cocoapods %s, looking for the nearest patch release", version)
+
+		available, err := remoteGemVersions("cocoapods", source)
+		if err != nil {
+			return "", "", fmt.Errorf("command failed, error: %s, failed to list the available cocoapods versions: %s", installErr, err)
+		}
+
+		fallbackVersion = nearestPatchVersion(version, available)
+		if fallbackVersion == "" {
+			return "", "", fmt.Errorf("command failed, error: %s, no other patch release of cocoapods %s found", installErr, version)
+		}
+
+		log.Warnf("Falling back to cocoapods %s", fallbackVersion)
+		version = fallbackVersion
+	}
+}
+
+// cocoapodsPodCmdSlice returns the pod command running the cocoapods version installed with the install mode.
+func cocoapodsPodCmdSlice(env GemEnvironment, mode GemInstallMode, gemDir, version string) []string {
+	podCmdSlice := []string{"pod"}
+	switch mode {
+	case GemInstallModeIsolated:
+		return isolatedPodCmdSlice(gemDir)
+	case GemInstallModeUserInstall:
+		// the user gem dir's bin is usually not in the PATH
+		if userPodPth := filepath.Join(env.UserInstallationDir, "bin", "pod"); isPathExists(userPodPth) {
+			podCmdSlice = []string{userPodPth}
+		}
+	}
+	return append(podCmdSlice, fmt.Sprintf("_%s_", version))
+}
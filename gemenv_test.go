@@ -0,0 +1,160 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testGemEnvOutput = `RubyGems Environment:
+  - RUBYGEMS VERSION: 3.1.6
+  - RUBY VERSION: 2.7.4 (2021-07-07 patchlevel 191) [x86_64-darwin20]
+  - INSTALLATION DIRECTORY: /Users/vagrant/.rbenv/versions/2.7.4/lib/ruby/gems/2.7.0
+  - USER INSTALLATION DIRECTORY: /Users/vagrant/.gem/ruby/2.7.0
+  - RUBY EXECUTABLE: /Users/vagrant/.rbenv/versions/2.7.4/bin/ruby
+  - GIT EXECUTABLE: /usr/local/bin/git
+  - EXECUTABLE DIRECTORY: /Users/vagrant/.rbenv/versions/2.7.4/bin
+  - SPEC CACHE DIRECTORY: /Users/vagrant/.gem/specs
+  - SYSTEM CONFIGURATION DIRECTORY: /Users/vagrant/.rbenv/versions/2.7.4/etc
+  - RUBYGEMS PLATFORMS:
+     - ruby
+     - x86_64-darwin-20
+  - GEM PATHS:
+     - /Users/vagrant/.rbenv/versions/2.7.4/lib/ruby/gems/2.7.0
+     - /Users/vagrant/.gem/ruby/2.7.0
+  - GEM CONFIGURATION:
+     - :update_sources => true
+     - :verbose => true
+  - REMOTE SOURCES:
+     - https://rubygems.org/
+  - SHELL PATH:
+     - /usr/local/bin
+     - /usr/bin`
+
+func TestParseGemEnvironment(t *testing.T) {
+	t.Log("gem env output")
+	{
+		env := parseGemEnvironment(testGemEnvOutput)
+		require.Equal(t, GemEnvironment{
+			RubygemsVersion:     "3.1.6",
+			RubyVersion:         "2.7.4",
+			RubyPlatform:        "x86_64-darwin20",
+			InstallationDir:     "/Users/vagrant/.rbenv/versions/2.7.4/lib/ruby/gems/2.7.0",
+			UserInstallationDir: "/Users/vagrant/.gem/ruby/2.7.0",
+			ExecutableDir:       "/Users/vagrant/.rbenv/versions/2.7.4/bin",
+			Platforms:           []string{"ruby", "x86_64-darwin-20"},
+			GemPaths:            []string{"/Users/vagrant/.rbenv/versions/2.7.4/lib/ruby/gems/2.7.0", "/Users/vagrant/.gem/ruby/2.7.0"},
+		}, env)
+	}
+
+	t.Log("empty ruby version")
+	{
+		env := parseGemEnvironment("RubyGems Environment:\n  - RUBYGEMS VERSION: 3.1.6\n  - RUBY VERSION: \n  - RUBY VERSION:")
+		require.Equal(t, GemEnvironment{RubygemsVersion: "3.1.6"}, env)
+	}
+}
+
+func TestGemInstallMode(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "gemenv")
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, os.RemoveAll(tmpDir))
+	}()
+
+	t.Log("isolated gem dir")
+	{
+		require.Equal(t, GemInstallModeIsolated, gemInstallMode(GemEnvironment{IsInstallationDirWritable: true}, "/gems"))
+	}
+
+	t.Log("writable installation dir")
+	{
+		require.Equal(t, GemInstallModeDefault, gemInstallMode(GemEnvironment{IsInstallationDirWritable: true}, ""))
+	}
+
+	t.Log("not existing, but creatable user installation dir")
+	{
+		env := GemEnvironment{UserInstallationDir: filepath.Join(tmpDir, ".gem", "ruby", "2.7.0")}
+		require.Equal(t, GemInstallModeUserInstall, gemInstallMode(env, ""))
+	}
+
+	t.Log("no user installation dir")
+	{
+		require.Equal(t, GemInstallModeSudo, gemInstallMode(GemEnvironment{}, ""))
+	}
+}
+
+func TestGemInstallModeCmdSlice(t *testing.T) {
+	slice := []string{"gem", "install", "cocoapods", "-v", "1.10.1"}
+
+	require.Equal(t, slice, gemInstallModeCmdSlice(GemInstallModeDefault, slice))
+	require.Equal(t, []string{"sudo", "gem", "install", "cocoapods", "-v", "1.10.1"}, gemInstallModeCmdSlice(GemInstallModeSudo, slice))
+	require.Equal(t, []string{"gem", "install", "cocoapods", "-v", "1.10.1", "--user-install"}, gemInstallModeCmdSlice(GemInstallModeUserInstall, slice))
+}
+
+func TestInstallCocoapodsGem(t *testing.T) {
+	baseDir, err := ioutil.TempDir("", "gems")
+	require.NoError(t, err)
+	defer func() { require.NoError(t, os.RemoveAll(baseDir)) }()
+
+	t.Log("installed in the isolated gem dir")
+	{
+		env := GemEnvironment{RubyVersion: "2.7.4"}
+		gemDir := isolatedGemDir(baseDir, env.RubyVersion, "1.11.3")
+		require.NoError(t, os.MkdirAll(filepath.Join(gemDir, "specifications"), 0755))
+		require.NoError(t, ioutil.WriteFile(filepath.Join(gemDir, "specifications", "cocoapods-1.11.3.gemspec"), nil, 0644))
+
+		version, installedGemDir, err := installCocoapodsGem("1.11.3", env, GemInstallModeIsolated, baseDir, VersionFallbackNone, GemSource{}, baseDir)
+		require.NoError(t, err)
+		require.Equal(t, "1.11.3", version)
+		require.Equal(t, gemDir, installedGemDir)
+	}
+}
+
+func TestCocoapodsPodCmdSlice(t *testing.T) {
+	userDir, err := ioutil.TempDir("", "user-gems")
+	require.NoError(t, err)
+	defer func() { require.NoError(t, os.RemoveAll(userDir)) }()
+
+	env := GemEnvironment{UserInstallationDir: userDir}
+
+	require.Equal(t, []string{"pod", "_1.11.3_"}, cocoapodsPodCmdSlice(env, GemInstallModeDefault, "", "1.11.3"))
+	require.Equal(t, []string{"pod", "_1.11.3_"}, cocoapodsPodCmdSlice(env, GemInstallModeSudo, "", "1.11.3"))
+	require.Equal(t, []string{"/gems/cocoapods-1.11.3/bin/pod"}, cocoapodsPodCmdSlice(env, GemInstallModeIsolated, "/gems/cocoapods-1.11.3", "1.11.3"))
+
+	t.Log("user install")
+	{
+		require.Equal(t, []string{"pod", "_1.11.3_"}, cocoapodsPodCmdSlice(env, GemInstallModeUserInstall, "", "1.11.3"))
+
+		userPodPth := filepath.Join(userDir, "bin", "pod")
+		require.NoError(t, os.MkdirAll(filepath.Dir(userPodPth), 0755))
+		require.NoError(t, ioutil.WriteFile(userPodPth, nil, 0755))
+		require.Equal(t, []string{userPodPth, "_1.11.3_"}, cocoapodsPodCmdSlice(env, GemInstallModeUserInstall, "", "1.11.3"))
+	}
+}
+
+func TestIsGemVersionInstalled(t *testing.T) {
+	output := `*** LOCAL GEMS ***
+
+cocoapods (1.11.0, 1.10.2, default: 1.9.3)
+cocoapods-core (1.1.0)
+nokogiri (1.11.1 x86_64-darwin, 1.10.10)`
+
+	require.True(t, isGemVersionInstalled(output, "cocoapods", "1.11.0"))
+	require.True(t, isGemVersionInstalled(output, "cocoapods", "1.10.2"))
+	require.True(t, isGemVersionInstalled(output, "cocoapods", "1.9.3"))
+	require.True(t, isGemVersionInstalled(output, "nokogiri", "1.11.1"))
+
+	require.False(t, isGemVersionInstalled(output, "cocoapods", "1.1.0"))
+	require.False(t, isGemVersionInstalled(output, "cocoapods", "1.10"))
+	require.False(t, isGemVersionInstalled(output, "cocoapods", "1.0.2"))
+}
+
+func TestParseGemListVersions(t *testing.T) {
+	output := `cocoapods (1.11.3, 1.11.2, default: 1.9.3)
+cocoapods-core (1.11.3)`
+	require.Equal(t, []string{"1.11.3", "1.11.2", "1.9.3"}, parseGemListVersions(output, "cocoapods"))
+	require.Nil(t, parseGemListVersions(output, "fastlane"))
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/bitrise-io/go-steputils/command/gems"
+	"github.com/bitrise-io/go-steputils/tools"
+	"github.com/bitrise-io/go-utils/command"
+	"github.com/bitrise-io/go-utils/fileutil"
+	"github.com/bitrise-io/go-utils/log"
+)
+
+// GemPlatform is a RubyGems platform, like x86_64-darwin-19 or arm64-darwin.
+type GemPlatform struct {
+	CPU     string
+	OS      string
+	Version string
+}
+
+const genericGemPlatform = "ruby"
+
+// parseGemPlatform parses a RubyGems platform string, the cpu and the version are optional: java, x86_64-linux, x86_64-darwin-19.
+func parseGemPlatform(platform string) GemPlatform {
+	parts := strings.SplitN(platform, "-", 3)
+	switch len(parts) {
+	case 1:
+		return GemPlatform{OS: parts[0]}
+	case 2:
+		return GemPlatform{CPU: parts[0], OS: parts[1]}
+	default:
+		return GemPlatform{CPU: parts[0], OS: parts[1], Version: parts[2]}
+	}
+}
+
+// matches checks if the lockfile platform covers the local platform, the same way bundler does:
+// a universal or missing cpu and a missing os version match any.
+func (p GemPlatform) matches(local GemPlatform) bool {
+	if p.OS != local.OS {
+		return false
+	}
+	if p.CPU != "" && p.CPU != "universal" && local.CPU != "" && local.CPU != "universal" && p.CPU != local.CPU {
+		return false
+	}
+	return p.Version == "" || local.Version == "" || p.Version == local.Version
+}
+
+// parseGemfileLockPlatforms returns the platforms listed in the PLATFORMS section of the Gemfile.lock.
+func parseGemfileLockPlatforms(content string) []string {
+	var platforms []string
+	for _, line := range gemfileLockSectionLines(content, "PLATFORMS") {
+		if platform := strings.TrimSpace(line); platform != "" {
+			platforms = append(platforms, platform)
+		}
+	}
+	return platforms
+}
+
+// isGemfileLockPlatformSupported checks if bundler can install the bundle on the local platform:
+// the lockfile lists the generic ruby platform, or a platform matching the local one.
+func isGemfileLockPlatformSupported(lockPlatforms []string, localPlatform string) bool {
+	local := parseGemPlatform(localPlatform)
+	for _, platform := range lockPlatforms {
+		if platform == genericGemPlatform || parseGemPlatform(platform).matches(local) {
+			return true
+		}
+	}
+	return false
+}
+
+// localGemPlatform returns the platform of the running ruby, as RubyGems and bundler see it.
+// Falls back to the last platform of the `gem env` RUBYGEMS PLATFORMS list.
+func localGemPlatform(env GemEnvironment) (string, error) {
+	out, err := command.New("ruby", "-e", "puts Gem::Platform.local.to_s").RunAndReturnTrimmedCombinedOutput()
+	if err == nil && out != "" && !strings.Contains(out, "\n") {
+		return out, nil
+	}
+
+	for i := len(env.Platforms) - 1; i >= 0; i-- {
+		if env.Platforms[i] != genericGemPlatform {
+			return env.Platforms[i], nil
+		}
+	}
+	return "", fmt.Errorf("failed to get the local ruby platform: %s, %s", out, err)
+}
+
+// bundleLockAddPlatformCmdSlice returns the command adding the platform to the Gemfile.lock.
+func bundleLockAddPlatformCmdSlice(bundler gems.Version, platform string) []string {
+	slice := []string{"bundle"}
+	if bundler.Found {
+		slice = append(slice, "_"+bundler.Version+"_")
+	}
+	return append(slice, "lock", "--add-platform", platform)
+}
+
+// exportGemfileLock copies the modified Gemfile.lock into the deploy dir, so it can be downloaded and committed.
+func exportGemfileLock(gemfileLockPth, deployDir string) {
+	if deployDir == "" {
+		log.Warnf("Commit the modified %s to the repository", gemfileLockPth)
+		return
+	}
+
+	content, err := fileutil.ReadBytesFromFile(gemfileLockPth)
+	if err != nil {
+		log.Warnf("Failed to read %s, error: %s", gemfileLockPth, err)
+		return
+	}
+
+	pth := filepath.Join(deployDir, filepath.Base(gemfileLockPth))
+	if err := fileutil.WriteBytesToFile(pth, content); err != nil {
+		log.Warnf("Failed to write %s, error: %s", pth, err)
+		return
+	}
+	log.Warnf("Commit the modified Gemfile.lock (exported to %s) to the repository", pth)
+
+	if err := tools.ExportEnvironmentWithEnvman("COCOAPODS_GEMFILE_LOCK_PATH", pth); err != nil {
+		log.Warnf("Failed to export COCOAPODS_GEMFILE_LOCK_PATH, error: %s", err)
+	}
+}
+
+// checkGemfileLockPlatforms checks that the Gemfile.lock platforms include the local platform, as bundler 2.2+ refuses
+// to install a bundle locked on another platform. The missing platform is added if addPlatform is set, otherwise a warning is logged.
+func checkGemfileLockPlatforms(gemfileLockPth string, bundler gems.Version, addPlatform bool, deployDir string) error {
+	fmt.Println()
+	log.Infof("Checking gem lockfile platforms")
+
+	content, err := fileutil.ReadStringFromFile(gemfileLockPth)
+	if err != nil {
+		return fmt.Errorf("failed to read file (%s) contents, error: %s", gemfileLockPth, err)
+	}
+
+	gemEnv, err := gemEnvironment()
+	if err != nil {
+		log.Warnf("Failed to get gem environment, error: %s", err)
+	}
+
+	lockPlatforms := parseGemfileLockPlatforms(content)
+	localPlatform, err := localGemPlatform(gemEnv)
+	if err != nil {
+		log.Warnf("Skipping gem lockfile platform check: %s", err)
+		return nil
+	}
+
+	if isGemfileLockPlatformSupported(lockPlatforms, localPlatform) {
+		log.Donef("Gem lockfile platforms (%s) support the local platform (%s)", strings.Join(lockPlatforms, ", "), localPlatform)
+		return nil
+	}
+	if !addPlatform {
+		log.Warnf("Gem lockfile platforms (%s) do not include the local platform (%s), bundle install may fail", strings.Join(lockPlatforms, ", "), localPlatform)
+		log.Warnf("Run `bundle lock --add-platform %s` and commit the Gemfile.lock, or enable the add_gemfile_lock_platform input", localPlatform)
+		return nil
+	}
+
+	log.Warnf("Gem lockfile platforms (%s) do not include the local platform (%s), adding it", strings.Join(lockPlatforms, ", "), localPlatform)
+
+	if err := runGemCommandWithRetry(func() (*command.Model, error) {
+		return command.NewFromSlice(bundleLockAddPlatformCmdSlice(bundler, localPlatform))
+	}, filepath.Dir(gemfileLockPth)); err != nil {
+		return fmt.Errorf("failed to add platform (%s) to the gem lockfile, error: %s", localPlatform, err)
+	}
+
+	exportGemfileLock(gemfileLockPth, deployDir)
+	return nil
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/bitrise-io/go-steputils/command/gems"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseGemPlatform(t *testing.T) {
+	require.Equal(t, GemPlatform{OS: "java"}, parseGemPlatform("java"))
+	require.Equal(t, GemPlatform{CPU: "x86_64", OS: "linux"}, parseGemPlatform("x86_64-linux"))
+	require.Equal(t, GemPlatform{CPU: "x86_64", OS: "darwin", Version: "19"}, parseGemPlatform("x86_64-darwin-19"))
+	require.Equal(t, GemPlatform{CPU: "x86_64", OS: "linux", Version: "musl"}, parseGemPlatform("x86_64-linux-musl"))
+}
+
+func TestParseGemfileLockPlatforms(t *testing.T) {
+	content := `GEM
+  remote: https://rubygems.org/
+  specs:
+    cocoapods (1.11.3)
+
+PLATFORMS
+  arm64-darwin-21
+  x86_64-darwin-19
+
+DEPENDENCIES
+  cocoapods
+`
+	require.Equal(t, []string{"arm64-darwin-21", "x86_64-darwin-19"}, parseGemfileLockPlatforms(content))
+	require.Nil(t, parseGemfileLockPlatforms("DEPENDENCIES\n  cocoapods\n"))
+}
+
+func TestIsGemfileLockPlatformSupported(t *testing.T) {
+	t.Log("exact match")
+	require.True(t, isGemfileLockPlatformSupported([]string{"arm64-darwin-21", "x86_64-darwin-19"}, "x86_64-darwin-19"))
+
+	t.Log("generic ruby platform")
+	require.True(t, isGemfileLockPlatformSupported([]string{"ruby"}, "x86_64-darwin-19"))
+
+	t.Log("lock platform without os version")
+	require.True(t, isGemfileLockPlatformSupported([]string{"x86_64-darwin"}, "x86_64-darwin-21"))
+
+	t.Log("universal cpu")
+	require.True(t, isGemfileLockPlatformSupported([]string{"universal-darwin"}, "arm64-darwin-22"))
+
+	t.Log("other cpu")
+	require.False(t, isGemfileLockPlatformSupported([]string{"arm64-darwin-21"}, "x86_64-darwin-21"))
+
+	t.Log("other os version")
+	require.False(t, isGemfileLockPlatformSupported([]string{"x86_64-darwin-19"}, "x86_64-darwin-21"))
+
+	t.Log("other os")
+	require.False(t, isGemfileLockPlatformSupported([]string{"x86_64-linux"}, "x86_64-darwin-21"))
+
+	t.Log("no platforms")
+	require.False(t, isGemfileLockPlatformSupported(nil, "x86_64-darwin-21"))
+}
+
+func TestBundleLockAddPlatformCmdSlice(t *testing.T) {
+	require.Equal(t, []string{"bundle", "_2.3.26_", "lock", "--add-platform", "x86_64-darwin-21"}, bundleLockAddPlatformCmdSlice(gems.Version{Version: "2.3.26", Found: true}, "x86_64-darwin-21"))
+	require.Equal(t, []string{"bundle", "lock", "--add-platform", "arm64-darwin-22"}, bundleLockAddPlatformCmdSlice(gems.Version{}, "arm64-darwin-22"))
+}
+
+func TestCheckGemfileLockPlatforms(t *testing.T) {
+	t.Log("missing gem lockfile")
+	{
+		require.Error(t, checkGemfileLockPlatforms("/missing/Gemfile.lock", gems.Version{}, false, ""))
+	}
+}
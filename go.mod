@@ -9,7 +9,7 @@ require (
 	github.com/bitrise-io/go-utils v0.0.0-20210506064210-b22e2b7b3ad3
 	github.com/bitrise-io/go-xcode v0.0.0-20210506065716-dfbf48d9980d // indirect
 	github.com/bitrise-io/stepman v0.0.0-20210505110307-5c2296bcc558 // indirect
-	github.com/bitrise-io/xcode-project v0.0.0-20210302080829-f3e0bfbcd5cb // indirect
+	github.com/bitrise-io/xcode-project v0.0.0-20210302080829-f3e0bfbcd5cb
 	github.com/pkg/errors v0.9.1
 	github.com/stretchr/testify v1.7.0
 	golang.org/x/text v0.3.6 // indirect
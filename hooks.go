@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/bitrise-io/go-utils/command"
+	"github.com/bitrise-io/go-utils/log"
+)
+
+// HookFailurePolicy is what to do if a hook script exits with a non-zero status.
+type HookFailurePolicy string
+
+// HookFailurePolicies ...
+const (
+	HookFailurePolicyFail HookFailurePolicy = "fail"
+	HookFailurePolicyWarn HookFailurePolicy = "warn"
+)
+
+// Hooks ...
+const (
+	HookPreInstall  = "pre_install"
+	HookPostInstall = "post_install"
+)
+
+// HookScripts are the pre- and post-install scripts, and what to do if they fail.
+type HookScripts struct {
+	PreInstall    string
+	PostInstall   string
+	FailurePolicy HookFailurePolicy
+}
+
+// run runs the script of the hook, if it is set.
+func (h HookScripts) run(hook string, ctx HookContext, envs []string) error {
+	script := h.PreInstall
+	if hook == HookPostInstall {
+		script = h.PostInstall
+	}
+	return runHookScript(hook, script, ctx, envs, h.FailurePolicy)
+}
+
+// HookContext is what the step resolved, exported to the hook scripts.
+type HookContext struct {
+	PodCmdSlice    []string
+	PodVersion     string
+	PodfilePth     string
+	PodfileLockPth string
+	WorkspacePth   string
+	UseBundler     bool
+}
+
+// hookEnvs returns the environment variables describing the resolved context of the hook.
+func hookEnvs(hook string, ctx HookContext) []string {
+	return []string{
+		"COCOAPODS_HOOK=" + hook,
+		"COCOAPODS_POD_COMMAND=" + strings.Join(ctx.PodCmdSlice, " "),
+		"COCOAPODS_HOOK_POD_VERSION=" + ctx.PodVersion,
+		"COCOAPODS_PODFILE_PATH=" + ctx.PodfilePth,
+		"COCOAPODS_PODFILE_LOCK_PATH=" + ctx.PodfileLockPth,
+		"COCOAPODS_WORKSPACE_PATH=" + ctx.WorkspacePth,
+		"COCOAPODS_USE_BUNDLER=" + strconv.FormatBool(ctx.UseBundler),
+	}
+}
+
+// findWorkspace returns the first workspace next to the Podfile, or an empty string if there is none yet.
+func findWorkspace(podfileDir string) (string, error) {
+	workspaces, err := filepath.Glob(filepath.Join(podfileDir, "*.xcworkspace"))
+	if err != nil {
+		return "", err
+	}
+	if len(workspaces) == 0 {
+		return "", nil
+	}
+	sort.Strings(workspaces)
+	return workspaces[0], nil
+}
+
+// runHookScript runs the script with bash in the Podfile's directory, with the resolved context exported.
+func runHookScript(hook, script string, ctx HookContext, envs []string, policy HookFailurePolicy) error {
+	if script == "" {
+		return nil
+	}
+
+	fmt.Println()
+	log.Infof("Running %s script", hook)
+
+	if ctx.WorkspacePth == "" {
+		workspacePth, err := findWorkspace(filepath.Dir(ctx.PodfilePth))
+		if err != nil {
+			log.Warnf("Failed to search for the workspace, error: %s", err)
+		}
+		ctx.WorkspacePth = workspacePth
+	}
+
+	cmd := command.New("bash", "-c", script)
+	cmd.SetStdout(os.Stdout).SetStderr(os.Stderr)
+	cmd.SetDir(filepath.Dir(ctx.PodfilePth))
+	cmd.AppendEnvs(append(append([]string{}, envs...), hookEnvs(hook, ctx)...)...)
+
+	for _, env := range hookEnvs(hook, ctx) {
+		log.Printf("%s", env)
+	}
+	fmt.Println()
+
+	if err := runCommand(cmd); err != nil {
+		if policy == HookFailurePolicyWarn {
+			log.Warnf("The %s script failed, error: %s", hook, err)
+			return nil
+		}
+		return fmt.Errorf("the %s script failed, error: %s", hook, err)
+	}
+
+	log.Donef("The %s script finished", hook)
+	return nil
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHookEnvs(t *testing.T) {
+	require.Equal(t, []string{
+		"COCOAPODS_HOOK=pre_install",
+		"COCOAPODS_POD_COMMAND=bundle _2.3.26_ exec pod",
+		"COCOAPODS_HOOK_POD_VERSION=1.11.3",
+		"COCOAPODS_PODFILE_PATH=/project/ios/Podfile",
+		"COCOAPODS_PODFILE_LOCK_PATH=/project/ios/Podfile.lock",
+		"COCOAPODS_WORKSPACE_PATH=",
+		"COCOAPODS_USE_BUNDLER=true",
+	}, hookEnvs(HookPreInstall, HookContext{
+		PodCmdSlice:    []string{"bundle", "_2.3.26_", "exec", "pod"},
+		PodVersion:     "1.11.3",
+		PodfilePth:     "/project/ios/Podfile",
+		PodfileLockPth: "/project/ios/Podfile.lock",
+		UseBundler:     true,
+	}))
+}
+
+func TestFindWorkspace(t *testing.T) {
+	podfileDir, err := ioutil.TempDir("", "hooks")
+	require.NoError(t, err)
+	defer func() { require.NoError(t, os.RemoveAll(podfileDir)) }()
+
+	pth, err := findWorkspace(podfileDir)
+	require.NoError(t, err)
+	require.Equal(t, "", pth)
+
+	require.NoError(t, os.MkdirAll(filepath.Join(podfileDir, "MyApp.xcworkspace"), 0755))
+	pth, err = findWorkspace(podfileDir)
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(podfileDir, "MyApp.xcworkspace"), pth)
+}
+
+func TestRunHookScript(t *testing.T) {
+	podfileDir, err := ioutil.TempDir("", "hooks")
+	require.NoError(t, err)
+	defer func() { require.NoError(t, os.RemoveAll(podfileDir)) }()
+
+	ctx := HookContext{
+		PodCmdSlice: []string{"pod", "_1.11.3_"},
+		PodVersion:  "1.11.3",
+		PodfilePth:  filepath.Join(podfileDir, "Podfile"),
+	}
+
+	t.Log("empty script")
+	{
+		require.NoError(t, runHookScript(HookPreInstall, "", ctx, nil, HookFailurePolicyFail))
+	}
+
+	t.Log("script sees the resolved context")
+	{
+		outPth := filepath.Join(podfileDir, "out.txt")
+		script := `echo "$COCOAPODS_HOOK|$COCOAPODS_POD_COMMAND|$COCOAPODS_USE_BUNDLER|$CUSTOM|$(pwd)" > out.txt`
+		require.NoError(t, runHookScript(HookPostInstall, script, ctx, []string{"CUSTOM=value"}, HookFailurePolicyFail))
+
+		content, err := ioutil.ReadFile(outPth)
+		require.NoError(t, err)
+		fields := strings.Split(strings.TrimSpace(string(content)), "|")
+		require.Equal(t, []string{"post_install", "pod _1.11.3_", "false", "value"}, fields[:4])
+		resolved, err := filepath.EvalSymlinks(podfileDir)
+		require.NoError(t, err)
+		require.Equal(t, resolved, fields[4])
+	}
+
+	t.Log("failing script")
+	{
+		require.Error(t, runHookScript(HookPreInstall, "exit 3", ctx, nil, HookFailurePolicyFail))
+		require.NoError(t, runHookScript(HookPreInstall, "exit 3", ctx, nil, HookFailurePolicyWarn))
+	}
+}
+
+func TestHookScripts(t *testing.T) {
+	podfileDir, err := ioutil.TempDir("", "hooks")
+	require.NoError(t, err)
+	defer func() { require.NoError(t, os.RemoveAll(podfileDir)) }()
+
+	ctx := HookContext{PodfilePth: filepath.Join(podfileDir, "Podfile")}
+	hooks := HookScripts{
+		PreInstall:    `echo pre > "$COCOAPODS_HOOK.txt"`,
+		PostInstall:   `echo post > "$COCOAPODS_HOOK.txt"`,
+		FailurePolicy: HookFailurePolicyFail,
+	}
+
+	t.Log("runs the script of the hook")
+	{
+		for hook, expected := range map[string]string{HookPreInstall: "pre", HookPostInstall: "post"} {
+			require.NoError(t, hooks.run(hook, ctx, nil))
+
+			content, err := ioutil.ReadFile(filepath.Join(podfileDir, hook+".txt"))
+			require.NoError(t, err)
+			require.Equal(t, expected, strings.TrimSpace(string(content)))
+		}
+	}
+
+	t.Log("applies the failure policy")
+	{
+		hooks := HookScripts{PostInstall: "exit 3", FailurePolicy: HookFailurePolicyWarn}
+		require.NoError(t, hooks.run(HookPreInstall, ctx, nil))
+		require.NoError(t, hooks.run(HookPostInstall, ctx, nil))
+	}
+}
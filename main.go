@@ -2,11 +2,15 @@ package main
 
 import (
 	"fmt"
+	"io"
+	"net/url"
 	"os"
 	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/bitrise-io/bitrise-init/scanners/ios"
 	"github.com/bitrise-io/bitrise-init/utility"
@@ -17,6 +21,7 @@ import (
 	"github.com/bitrise-io/go-utils/fileutil"
 	"github.com/bitrise-io/go-utils/log"
 	"github.com/bitrise-io/go-utils/pathutil"
+	"github.com/bitrise-io/go-utils/sliceutil"
 	"github.com/pkg/errors"
 )
 
@@ -26,6 +31,65 @@ type ConfigsModel struct {
 	PodfilePath     string
 	Verbose         string
 	IsCacheDisabled string
+
+	SpecRepos       string
+	GitHTTPUsername string
+	GitHTTPPassword string
+	GitHTTPHosts    string
+
+	SpecRepoUpdateJobs string
+	SpecRepoRevisions  string
+	SourceMirrors      string
+
+	GemSourceMirror   string
+	GemSourceUsername string
+	GemSourcePassword string
+
+	PodfileSearchExclude          string
+	PodfileSearchMaxDepth         string
+	PodfileSearchRespectGitignore string
+
+	ProjectPreconditionMode string
+
+	PodInstallArgs string
+	PodEnv         string
+
+	CommandTimeout         string
+	CommandNoOutputTimeout string
+
+	CocoapodsGemDir string
+
+	PodVersionMismatchPolicy string
+
+	VersionSource    string
+	CocoapodsVersion string
+	VersionFallback  string
+
+	PodfilePluginVersions string
+
+	BundleInstallMode string
+	BundleWith        string
+	BundleWithout     string
+	BundleFrozen      string
+	BundleJobs        string
+	BundleRetry       string
+	BundlePath        string
+
+	AddGemfileLockPlatform string
+
+	PreflightChecks string
+
+	DoctorMode string
+
+	PreInstallScript  string
+	PostInstallScript string
+	HookFailurePolicy string
+
+	PodsPatchesDir string
+
+	PodsBuildSettings string
+
+	DeployDir string
 }
 
 func createConfigsModelFromEnvs() ConfigsModel {
@@ -34,6 +98,65 @@ func createConfigsModelFromEnvs() ConfigsModel {
 		PodfilePath:     os.Getenv("podfile_path"),
 		Verbose:         os.Getenv("verbose"),
 		IsCacheDisabled: os.Getenv("is_cache_disabled"),
+
+		SpecRepos:       os.Getenv("spec_repos"),
+		GitHTTPUsername: os.Getenv("git_http_username"),
+		GitHTTPPassword: os.Getenv("git_http_password"),
+		GitHTTPHosts:    os.Getenv("git_http_hosts"),
+
+		SpecRepoUpdateJobs: os.Getenv("spec_repo_update_jobs"),
+		SpecRepoRevisions:  os.Getenv("spec_repo_revisions"),
+		SourceMirrors:      os.Getenv("source_mirrors"),
+
+		GemSourceMirror:   os.Getenv("gem_source_mirror"),
+		GemSourceUsername: os.Getenv("gem_source_username"),
+		GemSourcePassword: os.Getenv("gem_source_password"),
+
+		PodfileSearchExclude:          os.Getenv("podfile_search_exclude"),
+		PodfileSearchMaxDepth:         os.Getenv("podfile_search_max_depth"),
+		PodfileSearchRespectGitignore: os.Getenv("podfile_search_respect_gitignore"),
+
+		ProjectPreconditionMode: os.Getenv("project_precondition_mode"),
+
+		PodInstallArgs: os.Getenv("pod_install_args"),
+		PodEnv:         os.Getenv("pod_env"),
+
+		CommandTimeout:         os.Getenv("command_timeout"),
+		CommandNoOutputTimeout: os.Getenv("command_no_output_timeout"),
+
+		CocoapodsGemDir: os.Getenv("cocoapods_gem_dir"),
+
+		PodVersionMismatchPolicy: os.Getenv("pod_version_mismatch_policy"),
+
+		VersionSource:    os.Getenv("version_source"),
+		CocoapodsVersion: os.Getenv("cocoapods_version"),
+		VersionFallback:  os.Getenv("version_fallback"),
+
+		PodfilePluginVersions: os.Getenv("podfile_plugin_versions"),
+
+		BundleInstallMode: os.Getenv("bundle_install_mode"),
+		BundleWith:        os.Getenv("bundle_with"),
+		BundleWithout:     os.Getenv("bundle_without"),
+		BundleFrozen:      os.Getenv("bundle_frozen"),
+		BundleJobs:        os.Getenv("bundle_jobs"),
+		BundleRetry:       os.Getenv("bundle_retry"),
+		BundlePath:        os.Getenv("bundle_path"),
+
+		AddGemfileLockPlatform: os.Getenv("add_gemfile_lock_platform"),
+
+		PreflightChecks: os.Getenv("preflight_checks"),
+
+		DoctorMode: os.Getenv("doctor_mode"),
+
+		PreInstallScript:  os.Getenv("pre_install_script"),
+		PostInstallScript: os.Getenv("post_install_script"),
+		HookFailurePolicy: os.Getenv("hook_failure_policy"),
+
+		PodsPatchesDir: os.Getenv("pods_patches_dir"),
+
+		PodsBuildSettings: os.Getenv("pods_build_settings"),
+
+		DeployDir: os.Getenv("deploy_dir"),
 	}
 }
 
@@ -43,6 +166,56 @@ func (configs ConfigsModel) print() {
 	log.Printf("- PodfilePath: %s", configs.PodfilePath)
 	log.Printf("- Verbose: %s", configs.Verbose)
 	log.Printf("- IsCacheDisabled: %s", configs.IsCacheDisabled)
+	log.Printf("- SpecRepos: %s", redactSecrets(configs.SpecRepos))
+	log.Printf("- GitHTTPUsername: %s", configs.GitHTTPUsername)
+	log.Printf("- GitHTTPPassword: %s", redactSecrets(configs.GitHTTPPassword))
+	log.Printf("- GitHTTPHosts: %s", configs.GitHTTPHosts)
+	log.Printf("- SpecRepoUpdateJobs: %s", configs.SpecRepoUpdateJobs)
+	log.Printf("- SpecRepoRevisions: %s", configs.SpecRepoRevisions)
+	log.Printf("- SourceMirrors: %s", redactSecrets(configs.SourceMirrors))
+	log.Printf("- GemSourceMirror: %s", redactSecrets(configs.GemSourceMirror))
+	log.Printf("- GemSourceUsername: %s", configs.GemSourceUsername)
+	log.Printf("- GemSourcePassword: %s", redactSecrets(configs.GemSourcePassword))
+	log.Printf("- PodfileSearchExclude: %s", configs.PodfileSearchExclude)
+	log.Printf("- PodfileSearchMaxDepth: %s", configs.PodfileSearchMaxDepth)
+	log.Printf("- PodfileSearchRespectGitignore: %s", configs.PodfileSearchRespectGitignore)
+	log.Printf("- ProjectPreconditionMode: %s", configs.ProjectPreconditionMode)
+	log.Printf("- PodInstallArgs: %s", configs.PodInstallArgs)
+	log.Printf("- PodEnv: %s", redactSecrets(configs.PodEnv))
+	log.Printf("- CommandTimeout: %s", configs.CommandTimeout)
+	log.Printf("- CommandNoOutputTimeout: %s", configs.CommandNoOutputTimeout)
+	log.Printf("- CocoapodsGemDir: %s", configs.CocoapodsGemDir)
+	log.Printf("- PodVersionMismatchPolicy: %s", configs.PodVersionMismatchPolicy)
+	log.Printf("- VersionSource: %s", configs.VersionSource)
+	log.Printf("- CocoapodsVersion: %s", configs.CocoapodsVersion)
+	log.Printf("- VersionFallback: %s", configs.VersionFallback)
+	log.Printf("- PodfilePluginVersions: %s", configs.PodfilePluginVersions)
+	log.Printf("- BundleInstallMode: %s", configs.BundleInstallMode)
+	log.Printf("- BundleWith: %s", configs.BundleWith)
+	log.Printf("- BundleWithout: %s", configs.BundleWithout)
+	log.Printf("- BundleFrozen: %s", configs.BundleFrozen)
+	log.Printf("- BundleJobs: %s", configs.BundleJobs)
+	log.Printf("- BundleRetry: %s", configs.BundleRetry)
+	log.Printf("- BundlePath: %s", configs.BundlePath)
+	log.Printf("- AddGemfileLockPlatform: %s", configs.AddGemfileLockPlatform)
+	log.Printf("- PreflightChecks: %s", configs.PreflightChecks)
+	log.Printf("- DoctorMode: %s", configs.DoctorMode)
+	log.Printf("- PreInstallScript: %s", redactSecrets(configs.PreInstallScript))
+	log.Printf("- PostInstallScript: %s", redactSecrets(configs.PostInstallScript))
+	log.Printf("- HookFailurePolicy: %s", configs.HookFailurePolicy)
+	log.Printf("- PodsPatchesDir: %s", configs.PodsPatchesDir)
+	log.Printf("- PodsBuildSettings: %s", configs.PodsBuildSettings)
+	log.Printf("- DeployDir: %s", configs.DeployDir)
+}
+
+var boolOptions = []string{"true", "false"}
+
+// validateOption returns an error if the value of an optional parameter is set, but it is not one of the available values.
+func validateOption(name, value string, available []string) error {
+	if value == "" || sliceutil.IsStringInSlice(value, available) {
+		return nil
+	}
+	return fmt.Errorf(`invalid %s parameter specified: %s, available: ["%s"]`, name, value, strings.Join(available, `", "`))
 }
 
 func (configs ConfigsModel) validate() error {
@@ -63,16 +236,167 @@ func (configs ConfigsModel) validate() error {
 		}
 	}
 
-	if configs.Verbose != "" {
-		if configs.Verbose != "true" && configs.Verbose != "false" {
-			return fmt.Errorf(`invalid Verbose parameter specified: %s, available: ["true", "false"]`, configs.Verbose)
+	for _, option := range []struct {
+		name, value string
+		available   []string
+	}{
+		{"Verbose", configs.Verbose, boolOptions},
+		{"IsCacheDisabled", configs.IsCacheDisabled, boolOptions},
+		{"PodfileSearchRespectGitignore", configs.PodfileSearchRespectGitignore, boolOptions},
+		{"ProjectPreconditionMode", configs.ProjectPreconditionMode, []string{string(ProjectPreconditionModeWarn), string(ProjectPreconditionModeFail), string(ProjectPreconditionModeRun), string(ProjectPreconditionModeSkip)}},
+		{"PodVersionMismatchPolicy", configs.PodVersionMismatchPolicy, []string{string(PodVersionMismatchPolicyFail), string(PodVersionMismatchPolicyWarn)}},
+		{"VersionSource", configs.VersionSource, []string{string(VersionSourcePolicyGemfile), string(VersionSourcePolicyPodfileLock), string(VersionSourcePolicyExplicit), string(VersionSourcePolicyFailOnMismatch)}},
+		{"VersionFallback", configs.VersionFallback, []string{string(VersionFallbackNearestPatch), string(VersionFallbackNone)}},
+		{"BundleInstallMode", configs.BundleInstallMode, []string{string(BundleInstallModeAll), string(BundleInstallModeCocoapodsOnly)}},
+		{"BundleFrozen", configs.BundleFrozen, boolOptions},
+		{"AddGemfileLockPlatform", configs.AddGemfileLockPlatform, boolOptions},
+		{"PreflightChecks", configs.PreflightChecks, boolOptions},
+		{"DoctorMode", configs.DoctorMode, boolOptions},
+		{"HookFailurePolicy", configs.HookFailurePolicy, []string{string(HookFailurePolicyFail), string(HookFailurePolicyWarn)}},
+	} {
+		if err := validateOption(option.name, option.value, option.available); err != nil {
+			return err
+		}
+	}
+
+	specRepos, err := parseSpecRepos(configs.SpecRepos)
+	if err != nil {
+		return fmt.Errorf("invalid SpecRepos parameter specified: %s", err)
+	}
+
+	if (configs.GitHTTPUsername == "") != (configs.GitHTTPPassword == "") {
+		return errors.New("both GitHTTPUsername and GitHTTPPassword parameters need to be specified")
+	}
+	if configs.GitHTTPPassword != "" && len(credentialHosts(specRepos, parseHosts(configs.GitHTTPHosts))) == 0 {
+		return errors.New("GitHTTPPassword specified, but no https spec repo or GitHTTPHosts parameter specified")
+	}
+
+	if configs.SpecRepoUpdateJobs != "" {
+		if jobs, err := strconv.Atoi(configs.SpecRepoUpdateJobs); err != nil || jobs < 1 {
+			return fmt.Errorf("invalid SpecRepoUpdateJobs parameter specified: %s, should be a positive integer", configs.SpecRepoUpdateJobs)
+		}
+	}
+
+	if _, err := parseSpecRepoPins(configs.SpecRepoRevisions); err != nil {
+		return fmt.Errorf("invalid SpecRepoRevisions parameter specified: %s", err)
+	}
+
+	if _, err := parseSourceMirrors(configs.SourceMirrors); err != nil {
+		return fmt.Errorf("invalid SourceMirrors parameter specified: %s", err)
+	}
+
+	if configs.GemSourceMirror != "" {
+		if u, err := url.Parse(configs.GemSourceMirror); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			return fmt.Errorf("invalid GemSourceMirror parameter specified: %s, should be an http(s) url", configs.GemSourceMirror)
+		}
+	}
+	if (configs.GemSourceUsername == "") != (configs.GemSourcePassword == "") {
+		return errors.New("both GemSourceUsername and GemSourcePassword parameters need to be specified")
+	}
+	if configs.GemSourcePassword != "" && configs.GemSourceMirror == "" {
+		return errors.New("GemSourcePassword specified, but no GemSourceMirror parameter specified")
+	}
+
+	for _, pattern := range parseExcludePatterns(configs.PodfileSearchExclude) {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid PodfileSearchExclude pattern specified: %s, error: %s", pattern, err)
+		}
+	}
+	if configs.PodfileSearchMaxDepth != "" {
+		if depth, err := strconv.Atoi(configs.PodfileSearchMaxDepth); err != nil || depth < 0 {
+			return fmt.Errorf("invalid PodfileSearchMaxDepth parameter specified: %s, should be a non-negative integer", configs.PodfileSearchMaxDepth)
+		}
+	}
+
+	if _, err := splitShellWords(configs.PodInstallArgs); err != nil {
+		return fmt.Errorf("invalid PodInstallArgs parameter specified: %s", err)
+	}
+	if _, err := parsePodEnvs(configs.PodEnv); err != nil {
+		return fmt.Errorf("invalid PodEnv parameter specified: %s", err)
+	}
+
+	if configs.CommandTimeout != "" {
+		if timeout, err := strconv.Atoi(configs.CommandTimeout); err != nil || timeout < 0 {
+			return fmt.Errorf("invalid CommandTimeout parameter specified: %s, should be a non-negative integer", configs.CommandTimeout)
+		}
+	}
+	if configs.CommandNoOutputTimeout != "" {
+		if timeout, err := strconv.Atoi(configs.CommandNoOutputTimeout); err != nil || timeout < 0 {
+			return fmt.Errorf("invalid CommandNoOutputTimeout parameter specified: %s, should be a non-negative integer", configs.CommandNoOutputTimeout)
+		}
+	}
+
+	if VersionSourcePolicy(configs.VersionSource) == VersionSourcePolicyExplicit && configs.CocoapodsVersion == "" {
+		return errors.New("VersionSource is explicit, but no CocoapodsVersion parameter specified")
+	}
+	if configs.CocoapodsVersion != "" && !isValidVersion(configs.CocoapodsVersion) {
+		return fmt.Errorf("invalid CocoapodsVersion parameter specified: %s, should be an exact version, like 1.11.3", configs.CocoapodsVersion)
+	}
+
+	if _, err := parsePodfilePluginPins(configs.PodfilePluginVersions); err != nil {
+		return fmt.Errorf("invalid PodfilePluginVersions parameter specified: %s", err)
+	}
+
+	if configs.BundleFrozen == "true" && configs.BundleInstallMode == string(BundleInstallModeCocoapodsOnly) {
+		return fmt.Errorf("BundleFrozen can not be used with BundleInstallMode: %s, as it installs from a reduced Gemfile", BundleInstallModeCocoapodsOnly)
+	}
+	if _, err := parseBundleInstallCount(configs.BundleJobs, defaultBundleInstallJobs); err != nil {
+		return fmt.Errorf("invalid BundleJobs parameter specified: %s", err)
+	}
+	if _, err := parseBundleInstallCount(configs.BundleRetry, defaultBundleInstallRetry); err != nil {
+		return fmt.Errorf("invalid BundleRetry parameter specified: %s", err)
+	}
+	if configs.DoctorMode == "true" && configs.DeployDir == "" {
+		return errors.New("DoctorMode requires the DeployDir parameter to be specified")
+	}
+	if _, err := parseBuildSettingRules(configs.PodsBuildSettings); err != nil {
+		return fmt.Errorf("invalid PodsBuildSettings parameter specified: %s", err)
+	}
+
+	if configs.DeployDir != "" {
+		if exist, err := pathutil.IsDirExists(configs.DeployDir); err != nil {
+			return fmt.Errorf("failed to check if DeployDir exists at: %s, error: %s", configs.DeployDir, err)
+		} else if !exist {
+			return fmt.Errorf("DeployDir does not exist at: %s", configs.DeployDir)
 		}
 	}
 
 	return nil
 }
 
+var (
+	cleanupFuncsMu sync.Mutex
+	cleanupFuncs   []func()
+)
+
+// registerCleanup registers a function to be called before the step exits.
+func registerCleanup(fn func()) {
+	cleanupFuncsMu.Lock()
+	defer cleanupFuncsMu.Unlock()
+
+	cleanupFuncs = append(cleanupFuncs, fn)
+}
+
+// runCleanups calls the registered cleanup functions in reverse order, each of them at most once,
+// it is called both from the main goroutine and the interrupt handler.
+func runCleanups() {
+	cleanupFuncsMu.Lock()
+	funcs := cleanupFuncs
+	cleanupFuncs = nil
+	cleanupFuncsMu.Unlock()
+
+	for i := len(funcs) - 1; i >= 0; i-- {
+		funcs[i]()
+	}
+}
+
+// exitMu is locked by the goroutine exiting the step, and is never unlocked. Both the main goroutine and the interrupt handler
+// can exit the step: the first one runs the cleanups and exits, the other one blocks until the step exits.
+var exitMu sync.Mutex
+
 func failf(format string, v ...interface{}) {
+	exitMu.Lock()
+	runCleanups()
 	log.Errorf(format, v...)
 	os.Exit(1)
 }
@@ -100,15 +424,6 @@ func findMostRootPodfileInFileList(fileList []string) (string, error) {
 	return podfiles[0], nil
 }
 
-func findMostRootPodfile(dir string) (string, error) {
-	fileList, err := utility.ListPathInDirSortedByComponents(dir, false)
-	if err != nil {
-		return "", err
-	}
-
-	return findMostRootPodfileInFileList(fileList)
-}
-
 func cocoapodsVersionFromPodfileLockContent(content string) string {
 	exp := regexp.MustCompile("COCOAPODS: (.+)")
 	match := exp.FindStringSubmatch(content)
@@ -118,6 +433,18 @@ func cocoapodsVersionFromPodfileLockContent(content string) string {
 	return ""
 }
 
+// cocoapodsVersionFromVersionOutput returns the version printed by pod --version, ignoring the warnings printed before it.
+func cocoapodsVersionFromVersionOutput(output string) string {
+	exp := regexp.MustCompile(`^\d+(\.[0-9A-Za-z]+)+$`)
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	for i := len(lines) - 1; i >= 0; i-- {
+		if line := strings.TrimSpace(lines[i]); exp.MatchString(line) {
+			return line
+		}
+	}
+	return ""
+}
+
 func cocoapodsVersionFromPodfileLock(podfileLockPth string) (string, error) {
 	content, err := fileutil.ReadStringFromFile(podfileLockPth)
 	if err != nil {
@@ -126,121 +453,108 @@ func cocoapodsVersionFromPodfileLock(podfileLockPth string) (string, error) {
 	return cocoapodsVersionFromPodfileLockContent(content), nil
 }
 
-// VersionSpec ...
-type VersionSpec struct {
-	Operator string
-	Version  string
-}
+func main() {
+	handleInterrupts(commandKillGracePeriod)
+
+	configs := createConfigsModelFromEnvs()
+	registerSecret(configs.GitHTTPPassword)
+	registerSecret(configs.GemSourcePassword)
 
-func splitOperatorAndVersion(input string) (VersionSpec, error) {
-	splittedString := strings.Split(input, " ")
-	cnt := len(splittedString)
+	fmt.Println()
+	configs.print()
 
-	if cnt == 1 {
-		out := VersionSpec{"", splittedString[0]}
-		return out, nil
+	if err := configs.validate(); err != nil {
+		failf("Issue with input: %s", err)
 	}
 
-	if cnt != 2 {
-		err := fmt.Errorf("Invalid version range: %s", input)
-		return VersionSpec{}, err
+	specRepos, err := parseSpecRepos(configs.SpecRepos)
+	if err != nil {
+		failf("Failed to parse spec repos, error: %s", err)
 	}
 
-	out := VersionSpec{splittedString[0], splittedString[1]}
-	return out, nil
-}
+	specRepoPins, err := parseSpecRepoPins(configs.SpecRepoRevisions)
+	if err != nil {
+		failf("Failed to parse spec repo revisions, error: %s", err)
+	}
 
-func isIncludedInGemfileLockVersionRanges(input string, gemfileLockVersion string) (bool, error) {
-	var splittedVersions = strings.Split(gemfileLockVersion, ", ")
+	podInstallArgs, err := splitShellWords(configs.PodInstallArgs)
+	if err != nil {
+		failf("Failed to parse pod install args, error: %s", err)
+	}
 
-	for _, each := range splittedVersions {
-		versionSpec, err := splitOperatorAndVersion(each)
-		if err != nil {
-			return false, err
-		}
+	podEnvs, err := parsePodEnvs(configs.PodEnv)
+	if err != nil {
+		failf("Failed to parse pod envs, error: %s", err)
+	}
 
-		switch versionSpec.Operator {
-		case "":
-			if input != versionSpec.Version {
-				return false, nil
-			}
+	podfilePluginPins, err := parsePodfilePluginPins(configs.PodfilePluginVersions)
+	if err != nil {
+		failf("Failed to parse Podfile plugin versions, error: %s", err)
+	}
 
-			continue
-		case "~>":
-			if input != versionSpec.Version {
-				return false, nil
-			}
+	if configs.CommandTimeout != "" {
+		timeout, _ := strconv.Atoi(configs.CommandTimeout)
+		commandTimeouts.Timeout = time.Duration(timeout) * time.Second
+	}
+	if configs.CommandNoOutputTimeout != "" {
+		timeout, _ := strconv.Atoi(configs.CommandNoOutputTimeout)
+		commandTimeouts.InactivityTimeout = time.Duration(timeout) * time.Second
+	}
 
-			continue
-		case ">=":
-			versions := strings.Split(versionSpec.Version, ".")
-			inputVersions := strings.Split(input, ".")
-
-			for i, version := range versions {
-				v1, err := strconv.Atoi(version)
-				if err != nil {
-					return false, err
-				}
-
-				v2, err := strconv.Atoi(inputVersions[i])
-				if err != nil {
-					return false, err
-				}
-
-				if i != len(versions)-1 && v1 == v2 {
-					continue
-				}
-				if v2 >= v1 {
-					break
-				} else {
-					return false, nil
-				}
-			}
+	podLogPth := ""
+	if configs.DeployDir != "" {
+		podLogPth = filepath.Join(configs.DeployDir, "pod_install.log")
+	}
 
-			continue
-		case "<":
-			versions := strings.Split(versionSpec.Version, ".")
-			inputVersions := strings.Split(input, ".")
-
-			for i, version := range versions {
-				v1, err := strconv.Atoi(version)
-				if err != nil {
-					return false, err
-				}
-
-				v2, err := strconv.Atoi(inputVersions[i])
-				if err != nil {
-					return false, err
-				}
-
-				if i != len(versions)-1 && v1 == v2 {
-					continue
-				}
-				if v2 < v1 {
-					break
-				} else {
-					return false, nil
-				}
-			}
+	podLog, err := NewPodOutputLog(podLogPth)
+	if err != nil {
+		failf("Failed to create pod output log, error: %s", err)
+	}
+	registerCleanup(func() {
+		if err := podLog.Close(); err != nil {
+			log.Warnf("Failed to close pod output log, error: %s", err)
+		}
 
-			continue
-		default:
-			err := fmt.Errorf("Unknown version operator: %s", each)
-			return false, err
+		printAndExportPodMessages(parsePodMessages(podLog.String()), podLogPth, configs.DeployDir)
+	})
+
+	if configs.GitHTTPPassword != "" {
+		cleanup, err := setupGitCredentials(configs.GitHTTPUsername, configs.GitHTTPPassword, credentialHosts(specRepos, parseHosts(configs.GitHTTPHosts)))
+		if err != nil {
+			failf("Failed to set up git credentials, error: %s", err)
 		}
+		registerCleanup(cleanup)
 	}
 
-	return true, nil
-}
+	sourceMirrors, err := parseSourceMirrors(configs.SourceMirrors)
+	if err != nil {
+		failf("Failed to parse source mirrors, error: %s", err)
+	}
 
-func main() {
-	configs := createConfigsModelFromEnvs()
+	cdnMirrors, restoreSourceMirrors, err := setupSourceMirrors(sourceMirrors)
+	if err != nil {
+		failf("Failed to set up source mirrors, error: %s", err)
+	}
+	registerCleanup(restoreSourceMirrors)
 
-	fmt.Println()
-	configs.print()
+	gemSource := GemSource{
+		URL:      configs.GemSourceMirror,
+		Username: configs.GemSourceUsername,
+		Password: configs.GemSourcePassword,
+	}
 
-	if err := configs.validate(); err != nil {
-		failf("Issue with input: %s", err)
+	if gemSource.IsSet() {
+		envs, err := bundlerMirrorEnvs(gemSource)
+		if err != nil {
+			failf("Failed to create bundler mirror envs, error: %s", err)
+		}
+
+		for _, env := range envs {
+			split := strings.SplitN(env, "=", 2)
+			if err := os.Setenv(split[0], split[1]); err != nil {
+				failf("Failed to set env (%s), error: %s", split[0], err)
+			}
+		}
 	}
 
 	//
@@ -248,23 +562,15 @@ func main() {
 	podfilePath := ""
 
 	if configs.PodfilePath == "" {
-		fmt.Println()
-		log.Infof("Searching for Podfile")
-
-		absSourceRootPath, err := pathutil.AbsPath(configs.SourceRootPath)
-		if err != nil {
-			failf("Failed to expand (%s), error: %s", configs.SourceRootPath, err)
+		searchOpts := PodfileSearchOptions{ExcludePatterns: parseExcludePatterns(configs.PodfileSearchExclude)}
+		if configs.PodfileSearchMaxDepth != "" {
+			searchOpts.MaxDepth, _ = strconv.Atoi(configs.PodfileSearchMaxDepth)
 		}
 
-		absPodfilePath, err := findMostRootPodfile(absSourceRootPath)
+		absPodfilePath, err := searchPodfile(configs.SourceRootPath, searchOpts, configs.PodfileSearchRespectGitignore == "true")
 		if err != nil {
 			failf("Failed to find Podfile, error: %s", err)
 		}
-		if absPodfilePath == "" {
-			failf("No Podfile found")
-		}
-
-		log.Donef("Found Podfile: %s", absPodfilePath)
 
 		podfilePath = absPodfilePath
 	} else {
@@ -281,12 +587,17 @@ func main() {
 
 	podfileDir := filepath.Dir(podfilePath)
 
+	doctor := setupDoctor(configs.DoctorMode == "true", podfileDir, configs.DeployDir)
+
+	if err := checkProjectPreconditions(podfileDir, ProjectPreconditionMode(configs.ProjectPreconditionMode)); err != nil {
+		failf("Failed to check project preconditions, error: %s", err)
+	}
+
 	//
 	// Install required cocoapods version
 	fmt.Println()
 	log.Infof("Determining required cocoapods version")
 
-	useBundler := false
 	useCocoapodsVersionFromPodfileLock := ""
 	useCocoapodsVersionFromGemfileLock := ""
 
@@ -353,19 +664,52 @@ func main() {
 			useCocoapodsVersionFromGemfileLock = pod.Version
 			log.Donef("Required CocoaPods version (from gem lockfile): %s", useCocoapodsVersionFromGemfileLock)
 
-			isIncludedVersionRange, err := isIncludedInGemfileLockVersionRanges(useCocoapodsVersionFromPodfileLock, useCocoapodsVersionFromGemfileLock)
-			if err != nil {
-				failf("Failed to compare version range in gem lockfile, error: %s", err)
-			}
-
-			if !isIncludedVersionRange {
-				log.Warnf("Cocoapods version required in Podfile.lock (%s) does not match Gemfile.lock (%s). Will install Cocoapods using bundler.", useCocoapodsVersionFromPodfileLock, useCocoapodsVersionFromGemfileLock)
-			}
-			useBundler = true
 		}
 	} else {
 		log.Printf("No gem lockfile with cocoapods gem found at: %s", gemfileLockPth)
-		log.Donef("Using system installed CocoaPods version")
+	}
+
+	versionSource := VersionSourcePolicy(configs.VersionSource)
+	if versionSource == "" {
+		versionSource = VersionSourcePolicyGemfile
+	}
+
+	decision, err := decideCocoapodsVersion(versionSource, useCocoapodsVersionFromPodfileLock, useCocoapodsVersionFromGemfileLock, configs.CocoapodsVersion)
+	if err != nil {
+		failf("Failed to determine CocoaPods version, error: %s", err)
+	}
+	useBundler := decision.UseBundler
+
+	doctor.PodfileLockPth = podfileLockPth
+	doctor.GemfileLockPth = gemfileLockPth
+	doctor.PodfileLockVersion = useCocoapodsVersionFromPodfileLock
+	doctor.GemfileLockVersion = useCocoapodsVersionFromGemfileLock
+	doctor.BundlerVersion = bundler.Version
+	doctor.Decision = decision
+
+	if decision.Version != "" {
+		log.Donef("Using CocoaPods %s from %s (%s)", decision.Version, decision.Source, decision.Reason)
+	} else {
+		log.Donef("Using system installed CocoaPods version (%s)", decision.Reason)
+	}
+	exportCocoapodsVersionDecision(decision)
+
+	if configs.PreflightChecks != "false" {
+		fmt.Println()
+		log.Infof("Running pre-flight checks")
+
+		results := runPreflightChecks(PreflightInput{
+			PodfileDir:      podfileDir,
+			PodfilePth:      podfilePath,
+			PodfileLockPth:  podfileLockPth,
+			GemfileLockPth:  gemfileLockPth,
+			RequiredVersion: decision.Version,
+			Env:             os.Getenv,
+			FreeDiskSpace:   freeDiskSpace,
+		})
+		if printPreflightResults(results) {
+			failf("Pre-flight checks failed, see the hints above")
+		}
 	}
 
 	// Check ruby version
@@ -384,8 +728,8 @@ func main() {
 			fmt.Println()
 
 			cmd := command.New("rbenv", "install", rversion).SetStdout(os.Stdout).SetStderr(os.Stderr)
-			log.Donef("$ %s", cmd.PrintableCommandArgs())
-			if err := cmd.Run(); err != nil {
+			log.Donef("$ %s", redactSecrets(cmd.PrintableCommandArgs()))
+			if err := runCommand(cmd); err != nil {
 				log.Errorf("Failed to install Ruby version %s, error: %s", rversion, err)
 			}
 		} else {
@@ -399,6 +743,9 @@ func main() {
 	log.Infof("Installing cocoapods")
 
 	podCmdSlice := []string{"pod"}
+	cocoapodsGemDir := ""
+	bundlePath := ""
+	var gemMode GemInstallMode
 
 	if useBundler {
 		fmt.Println()
@@ -406,156 +753,259 @@ func main() {
 
 		// install bundler with `gem install bundler [-v version]`
 		// in some configurations, the command "bunder _1.2.3_" can return 'Command not found', installing bundler solves this
-		installBundlerCommand := gems.InstallBundlerCommand(bundler)
-		installBundlerCommand.SetStdout(os.Stdout).SetStderr(os.Stderr)
-		installBundlerCommand.SetDir(podfileDir)
-
-		log.Donef("$ %s", installBundlerCommand.PrintableCommandArgs())
-		fmt.Println()
-
-		if err := installBundlerCommand.Run(); err != nil {
+		if err := runGemCommandWithRetry(func() (*command.Model, error) {
+			return installBundlerCommand(bundler, gemSource)
+		}, podfileDir); err != nil {
 			failf("command failed, error: %s", err)
 		}
 
-		// install gem lockfile gems with `bundle [_version_] install ...`
-		fmt.Println()
-		log.Infof("Installing cocoapods with bundler")
-
-		cmd, err := gems.BundleInstallCommand(bundler)
-		if err != nil {
-			failf("failed to create bundle command model, error: %s", err)
+		if err := checkGemfileLockPlatforms(gemfileLockPth, bundler, configs.AddGemfileLockPlatform == "true", configs.DeployDir); err != nil {
+			failf("Failed to check gem lockfile platforms, error: %s", err)
 		}
-		cmd.SetStdout(os.Stdout).SetStderr(os.Stderr)
-		cmd.SetDir(podfileDir)
 
-		log.Donef("$ %s", cmd.PrintableCommandArgs())
-		fmt.Println()
+		// install gem lockfile gems with `bundle [_version_] install ...`
+		bundleOpts := BundleInstallOptions{
+			Mode:    BundleInstallMode(configs.BundleInstallMode),
+			With:    parseBundleGroups(configs.BundleWith),
+			Without: parseBundleGroups(configs.BundleWithout),
+			Frozen:  configs.BundleFrozen == "true",
+		}
+		if bundleOpts.Jobs, err = parseBundleInstallCount(configs.BundleJobs, defaultBundleInstallJobs); err != nil {
+			failf("Failed to parse bundle jobs, error: %s", err)
+		}
+		if bundleOpts.Retry, err = parseBundleInstallCount(configs.BundleRetry, defaultBundleInstallRetry); err != nil {
+			failf("Failed to parse bundle retry, error: %s", err)
+		}
+		if configs.BundlePath != "" {
+			bundleOpts.Path = configs.BundlePath
+			if !filepath.IsAbs(bundleOpts.Path) {
+				bundleOpts.Path = filepath.Join(filepath.Dir(gemfileLockPth), bundleOpts.Path)
+			}
+			bundlePath = bundleOpts.Path
+		}
 
-		if err := cmd.Run(); err != nil {
-			failf("Command failed, error: %s", err)
+		if err := installBundle(bundler, bundleOpts, gemfileLockPth, podfileDir); err != nil {
+			failf("Failed to install the bundle, error: %s", err)
 		}
 
 		if useBundler {
 			podCmdSlice = append(gems.BundleExecPrefix(bundler), podCmdSlice...)
 		}
-	} else if useCocoapodsVersionFromPodfileLock != "" {
-		log.Printf("Checking cocoapods %s gem", useCocoapodsVersionFromPodfileLock)
-
-		installed, err := rubycommand.IsGemInstalled("cocoapods", useCocoapodsVersionFromPodfileLock)
+	} else if decision.Version != "" {
+		gemEnv, err := gemEnvironment()
 		if err != nil {
-			failf("Failed to check if cocoapods %s installed, error: %s", useCocoapodsVersionFromPodfileLock, err)
+			failf("Failed to get gem environment, error: %s", err)
 		}
 
-		if !installed {
-			log.Printf("Installing")
-
-			cmds, err := rubycommand.GemInstall("cocoapods", useCocoapodsVersionFromPodfileLock, false)
-			if err != nil {
-				failf("Failed to create command model, error: %s", err)
+		baseDir := ""
+		if configs.CocoapodsGemDir != "" {
+			if baseDir, err = pathutil.AbsPath(configs.CocoapodsGemDir); err != nil {
+				failf("Failed to expand path (%s), error: %s", configs.CocoapodsGemDir, err)
 			}
+		}
 
-			for _, cmd := range cmds {
-				log.Donef("$ %s", cmd.PrintableCommandArgs())
-
-				cmd.SetDir(podfileDir)
+		mode := gemInstallMode(gemEnv, baseDir)
+		gemMode = mode
+		log.Printf("Ruby %s (%s), gem installation dir: %s, install mode: %s", gemEnv.RubyVersion, gemEnv.RubyPlatform, gemEnv.InstallationDir, mode)
 
-				if err := cmd.Run(); err != nil {
-					failf("Command failed, error: %s", err)
-				}
-			}
-		} else {
-			log.Printf("Installed")
+		installedVersion, gemDir, err := installCocoapodsGem(decision.Version, gemEnv, mode, baseDir, VersionFallback(configs.VersionFallback), gemSource, podfileDir)
+		if err != nil {
+			failf("Failed to install cocoapods %s, error: %s", decision.Version, err)
+		}
+		if installedVersion != decision.Version {
+			decision.Reason += fmt.Sprintf(", %s could not be installed, fell back to the nearest patch release", decision.Version)
+			decision.Version = installedVersion
+			doctor.Decision = decision
+			exportCocoapodsVersionDecision(decision)
 		}
 
-		podCmdSlice = append(podCmdSlice, fmt.Sprintf("_%s_", useCocoapodsVersionFromPodfileLock))
+		cocoapodsGemDir = gemDir
+		podCmdSlice = cocoapodsPodCmdSlice(gemEnv, mode, cocoapodsGemDir, decision.Version)
+		if mode == GemInstallModeIsolated {
+			podEnvs = append(podEnvs, isolatedGemEnvs(cocoapodsGemDir)...)
+		}
 	} else {
 		log.Printf("Using system installed cocoapods")
 	}
 
-	fmt.Println()
-	log.Infof("cocoapods version:")
+	// Install Podfile plugins, with bundler the plugins are expected to be in the Gemfile
+	if !useBundler {
+		if err := checkPodfilePlugins(podfilePath, decision.Version, podEnvs, podfilePluginPins, gemMode, cocoapodsGemDir, gemSource); err != nil {
+			failf("Failed to install Podfile plugins, error: %s", err)
+		}
+	}
+
+	doctor.PodCmdSlice = podCmdSlice
+	doctor.PodEnvs = podEnvs
 
-	// pod can be in the PATH as an rbenv shim and pod --version will return "rbenv: pod: command not found"
-	cmd, err := rubycommand.NewFromSlice(append(podCmdSlice, "--version"))
+	podVersion, err := checkPodVersion(podCmdSlice, cocoapodsGemDir, podfileDir, podEnvs, decision.Version, decision.Source, PodVersionMismatchPolicy(configs.PodVersionMismatchPolicy), podLog)
+	doctor.PodVersion = podVersion
 	if err != nil {
-		failf("Failed to create command model, error: %s", err)
+		failf("%s", err)
 	}
 
-	cmd.SetStdout(os.Stdout).SetStderr(os.Stderr)
-	cmd.SetDir(podfileDir)
+	if len(podInstallArgs) > 0 {
+		warnings, err := validatePodInstallArgs(podInstallArgs, podVersion)
+		if err != nil {
+			failf("Invalid pod install args, error: %s", err)
+		}
+		for _, warning := range warnings {
+			log.Warnf("%s", warning)
+		}
+	}
+
+	if err := addSpecRepos(specRepos, podCmdSlice, podfileDir, podEnvs, podLog); err != nil {
+		failf("Failed to add spec repos, error: %s", err)
+	}
+
+	restoreSpecRepoPins, err := pinSpecRepos(specRepoPins, podLog)
+	if err != nil {
+		failf("Failed to pin spec repos, error: %s", err)
+	}
+	registerCleanup(restoreSpecRepoPins)
+	doctor.SpecRepoPins = specRepoPins
+
+	hookContext := HookContext{
+		PodCmdSlice:    podCmdSlice,
+		PodVersion:     podVersion,
+		PodfilePth:     podfilePath,
+		PodfileLockPth: podfileLockPth,
+		UseBundler:     useBundler,
+	}
+	hooks := HookScripts{
+		PreInstall:    configs.PreInstallScript,
+		PostInstall:   configs.PostInstallScript,
+		FailurePolicy: HookFailurePolicy(configs.HookFailurePolicy),
+	}
+	if err := hooks.run(HookPreInstall, hookContext, podEnvs); err != nil {
+		failf("%s", err)
+	}
 
-	log.Donef("$ %s", cmd.PrintableCommandArgs())
-	if err := cmd.Run(); err != nil {
-		failf("command failed, error: %s", err)
+	podsDir := filepath.Join(podfileDir, "Pods")
+	podPatches, removedPatchedPods, err := preparePodPatches(configs.PodsPatchesDir, podfileDir, podsDir)
+	if err != nil {
+		failf("Failed to prepare pod patches, error: %s", err)
 	}
 
 	// Run pod install
 	fmt.Println()
 	log.Infof("Installing Pods")
 
-	podInstallCmdSlice := append(podCmdSlice, "install", "--no-repo-update")
-	if configs.Verbose == "true" {
-		podInstallCmdSlice = append(podInstallCmdSlice, "--verbose")
-	}
+	var podInstallTimer *PodInstallTimer
+	registerCleanup(func() {
+		if podInstallTimer != nil {
+			printAndExportPodInstallTiming(podInstallTimer.Report(podInstallTimingSlowestCount), configs.DeployDir)
+		}
+	})
 
-	cmd, err = rubycommand.NewFromSlice(podInstallCmdSlice)
+	cmd, err := rubycommand.NewFromSlice(podInstallCmdSlice(podCmdSlice, true, configs.Verbose == "true", podInstallArgs))
 	if err != nil {
 		failf("Failed to create command model, error: %s", err)
 	}
 
-	cmd.SetStdout(os.Stdout).SetStderr(os.Stderr)
+	setIncompletePodsDir(filepath.Join(podfileDir, "Pods"))
+
+	podInstallTimer = NewPodInstallTimer()
+	cmd.SetStdout(podLog.Writer(io.MultiWriter(os.Stdout, podInstallTimer))).SetStderr(podLog.Writer(os.Stderr))
 	cmd.SetDir(podfileDir)
+	cmd.AppendEnvs(podEnvs...)
 
-	log.Donef("$ %s", cmd.PrintableCommandArgs())
-	if err := cmd.Run(); err != nil {
+	log.Donef("$ %s", redactSecrets(cmd.PrintableCommandArgs()))
+	if err := runCommand(cmd); err != nil {
 		log.Warnf("Command failed, error: %s, retrying without --no-repo-update ...", err)
 
 		// Repo update
-		cmd, err = rubycommand.NewFromSlice(append(podCmdSlice, "repo", "update"))
-		if err != nil {
-			failf("Failed to create command model, error: %s", err)
+		var sources []string
+		if isPodfileLockExists {
+			content, err := fileutil.ReadStringFromFile(podfileLockPth)
+			if err != nil {
+				failf("Failed to read file (%s) contents, error: %s", podfileLockPth, err)
+			}
+			sources = specRepoSourcesFromPodfileLockContent(content)
 		}
 
-		cmd.SetStdout(os.Stdout).SetStderr(os.Stderr)
-		cmd.SetDir(podfileDir)
+		localRepos, err := listLocalSpecRepos()
+		if err != nil {
+			failf("Failed to list spec repos, error: %s", err)
+		}
 
-		log.Donef("$ %s", cmd.PrintableCommandArgs())
-		if err := cmd.Run(); err != nil {
-			failf("Command failed, error: %s", err)
+		jobs := 4
+		if configs.SpecRepoUpdateJobs != "" {
+			jobs, _ = strconv.Atoi(configs.SpecRepoUpdateJobs)
 		}
 
-		// Pod install
-		podInstallCmdSlice := append(podCmdSlice, "install")
-		if configs.Verbose == "true" {
-			podInstallCmdSlice = append(podInstallCmdSlice, "--verbose")
+		repoNames := specReposToUpdateBeforeRetry(sources, localRepos, specRepoPins, len(cdnMirrors) > 0)
+		if err := runSpecRepoUpdate(repoNames, podCmdSlice, podfileDir, podEnvs, jobs, podLog); err != nil {
+			failf("Failed to update spec repos, error: %s", err)
 		}
 
-		cmd, err = rubycommand.NewFromSlice(podInstallCmdSlice)
+		// Pod install
+		cmd, err = rubycommand.NewFromSlice(podInstallCmdSlice(podCmdSlice, false, configs.Verbose == "true", podInstallArgs))
 		if err != nil {
 			failf("Failed to create command model, error: %s", err)
 		}
 
-		cmd.SetStdout(os.Stdout).SetStderr(os.Stderr)
+		podInstallTimer = NewPodInstallTimer()
+		cmd.SetStdout(podLog.Writer(io.MultiWriter(os.Stdout, podInstallTimer))).SetStderr(podLog.Writer(os.Stderr))
 		cmd.SetDir(podfileDir)
+		cmd.AppendEnvs(podEnvs...)
 
-		log.Donef("$ %s", cmd.PrintableCommandArgs())
-		if err := cmd.Run(); err != nil {
+		log.Donef("$ %s", redactSecrets(cmd.PrintableCommandArgs()))
+		if err := runCommand(cmd); err != nil {
 			failf("Command failed, error: %s", err)
 		}
 	}
 
+	setIncompletePodsDir("")
+
+	if err := applyPodPatches(podsDir, podfileLockPth, podPatches); err != nil {
+		failf("Failed to apply pod patches, error: %s", err)
+	}
+
+	buildSettingRules, err := parseBuildSettingRules(configs.PodsBuildSettings)
+	if err != nil {
+		failf("Failed to parse build setting rules, error: %s", err)
+	}
+	if err := runPodsBuildSettingRules(podsDir, buildSettingRules, configs.DeployDir); err != nil {
+		failf("Failed to normalize Pods project build settings, error: %s", err)
+	}
+
+	podsCacheIndicator := podfileLockPth
+	if len(podPatches) > 0 || len(buildSettingRules) > 0 || removedPatchedPods {
+		indicator, err := writePodsCacheIndicator(podsDir, podfileLockPth, podPatches, buildSettingRules)
+		if err != nil {
+			failf("Failed to write the Pods cache indicator, error: %s", err)
+		}
+		podsCacheIndicator = indicator
+	}
+
+	if err := hooks.run(HookPostInstall, hookContext, podEnvs); err != nil {
+		failf("%s", err)
+	}
+
 	// Collecting caches
-	if configs.IsCacheDisabled != "true" && isPodfileLockExists {
+	if isInterrupted() {
+		log.Warnf("Step interrupted, skipping cache collection")
+	} else if configs.IsCacheDisabled != "true" && isPodfileLockExists {
 		fmt.Println()
 		log.Infof("Collecting Pod cache paths...")
 
 		podsCache := cache.New()
-		podsCache.IncludePath(fmt.Sprintf("%s -> %s", filepath.Join(podfileDir, "Pods"), podfileLockPth))
+		podsCache.IncludePath(fmt.Sprintf("%s -> %s", podsDir, podsCacheIndicator))
+		if cocoapodsGemDir != "" {
+			podsCache.IncludePath(cocoapodsGemDir)
+		}
+		if bundlePath != "" {
+			podsCache.IncludePath(fmt.Sprintf("%s -> %s", bundlePath, gemfileLockPth))
+		}
 
 		if err := podsCache.Commit(); err != nil {
 			log.Warnf("Cache collection skipped: failed to commit cache paths.")
 		}
 	}
 
+	exitMu.Lock()
+	runCleanups()
+
 	log.Donef("Success!")
 }
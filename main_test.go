@@ -79,6 +79,25 @@ func TestFindMostRootPodfile(t *testing.T) {
 	}
 }
 
+func TestValidateOption(t *testing.T) {
+	t.Log("empty value")
+	{
+		require.NoError(t, validateOption("Verbose", "", boolOptions))
+	}
+
+	t.Log("available value")
+	{
+		require.NoError(t, validateOption("Verbose", "false", boolOptions))
+		require.NoError(t, validateOption("Policy", "warn", []string{"fail", "warn"}))
+	}
+
+	t.Log("invalid value")
+	{
+		require.EqualError(t, validateOption("Verbose", "yes", boolOptions), `invalid Verbose parameter specified: yes, available: ["true", "false"]`)
+		require.EqualError(t, validateOption("Policy", "ignore", []string{"fail", "warn"}), `invalid Policy parameter specified: ignore, available: ["fail", "warn"]`)
+	}
+}
+
 func TestCocoapodsVersionFromPodfileLockContent(t *testing.T) {
 	t.Log("Podfile.lock cocoapods")
 	{
@@ -119,40 +138,29 @@ PODFILE CHECKSUM: f2a6f4eed25b89d16fc8e906af222b4e63afa6c3
 	}
 }
 
-func TestIsIncludedInGemfileLockVersionRanges(t *testing.T) {
-	t.Log("Match version")
+func TestCocoapodsVersionFromVersionOutput(t *testing.T) {
+	t.Log("version only")
 	{
-		gemfileLockVersion := "1.0.0"
-
-		isIncluded, err := isIncludedInGemfileLockVersionRanges("1.0.0", gemfileLockVersion)
-		require.NoError(t, err)
-		require.True(t, isIncluded)
-		isExcluded, err := isIncludedInGemfileLockVersionRanges("2.0.0", gemfileLockVersion)
-		require.NoError(t, err)
-		require.False(t, isExcluded)
+		require.Equal(t, "1.10.1", cocoapodsVersionFromVersionOutput("1.10.1\n"))
 	}
 
-	t.Log("Specify version")
+	t.Log("version with warnings")
 	{
-		gemfileLockVersion := "~> 1.0.0"
+		output := `WARNING: CocoaPods requires your terminal to be using UTF-8 encoding.
+    Consider adding the following to ~/.profile:
 
-		isIncluded, err := isIncludedInGemfileLockVersionRanges("1.0.0", gemfileLockVersion)
-		require.NoError(t, err)
-		require.True(t, isIncluded)
-		isExcluded, err := isIncludedInGemfileLockVersionRanges("2.0.0", gemfileLockVersion)
-		require.NoError(t, err)
-		require.False(t, isExcluded)
+    export LANG=en_US.UTF-8
+1.9.3`
+		require.Equal(t, "1.9.3", cocoapodsVersionFromVersionOutput(output))
 	}
 
-	t.Log("Range version")
+	t.Log("prerelease version")
 	{
-		gemfileLockVersion := ">= 1.0.0, < 2.0.0"
+		require.Equal(t, "1.12.0.beta.1", cocoapodsVersionFromVersionOutput("1.12.0.beta.1\n"))
+	}
 
-		isIncluded, err := isIncludedInGemfileLockVersionRanges("1.0.0", gemfileLockVersion)
-		require.NoError(t, err)
-		require.True(t, isIncluded)
-		isExcluded, err := isIncludedInGemfileLockVersionRanges("2.0.0", gemfileLockVersion)
-		require.NoError(t, err)
-		require.False(t, isExcluded)
+	t.Log("shim error")
+	{
+		require.Equal(t, "", cocoapodsVersionFromVersionOutput("rbenv: pod: command not found"))
 	}
 }
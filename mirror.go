@@ -0,0 +1,298 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bitrise-io/go-utils/fileutil"
+	"github.com/bitrise-io/go-utils/log"
+	"github.com/bitrise-io/go-utils/pathutil"
+)
+
+const (
+	trunkCDNURL = "https://cdn.cocoapods.org/"
+	// cdnMirrorAliasSuffix is appended to the name of a mirrored CDN repo to get the name of its alias repo.
+	cdnMirrorAliasSuffix = "-mirror"
+)
+
+// sourceMirrorsScript is preloaded into the ruby processes started by the step.
+// Once CocoaPods is loaded, it redirects the source lookup of the mirrored CDN urls to their alias repos,
+// and lists the pods of the alias repos under the original source in the Podfile.lock.
+const sourceMirrorsScript = `require 'json'
+
+module CocoapodsInstallSourceMirrors
+  MIRRORS = JSON.parse(ENV.fetch('COCOAPODS_SOURCE_MIRRORS', '[]'))
+
+  def self.canonic_url(url)
+    url.to_s.downcase.strip.sub(%r{/+$}, '').sub(/\.git$/, '')
+  end
+
+  def self.find(key, url)
+    MIRRORS.find { |mirror| canonic_url(mirror[key]) == canonic_url(url) }
+  end
+
+  module SourceManager
+    def source_with_url(url)
+      mirror = CocoapodsInstallSourceMirrors.find('url', url)
+      (mirror && super(mirror['mirror'])) || super
+    end
+  end
+
+  module Lockfile
+    def generate_spec_repos(*args)
+      Hash[super.map { |key, pods|
+        mirror = CocoapodsInstallSourceMirrors.find('mirror', key)
+        [mirror ? mirror['lockfile_key'] : key, pods]
+      }]
+    end
+  end
+end
+
+TracePoint.new(:end) do |tp|
+  mod = tp.self
+  name = Module.instance_method(:name).bind(mod).call
+  if name == 'Pod::Source::Manager' && !mod.ancestors.include?(CocoapodsInstallSourceMirrors::SourceManager)
+    mod.prepend(CocoapodsInstallSourceMirrors::SourceManager)
+  elsif name == 'Pod::Lockfile' && !mod.singleton_class.ancestors.include?(CocoapodsInstallSourceMirrors::Lockfile)
+    mod.singleton_class.prepend(CocoapodsInstallSourceMirrors::Lockfile)
+  end
+end.enable
+`
+
+// SourceMirror maps a spec repo or git host url prefix to a mirror.
+type SourceMirror struct {
+	From string
+	To   string
+}
+
+// parseSourceMirrors parses the source_mirrors input, one mapping per line in FROM => TO format.
+func parseSourceMirrors(input string) ([]SourceMirror, error) {
+	var mirrors []SourceMirror
+
+	for _, line := range strings.Split(input, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		split := strings.Split(line, "=>")
+		if len(split) != 2 {
+			return nil, fmt.Errorf("invalid source mirror: %s, expected format: FROM => TO", line)
+		}
+
+		mirror := SourceMirror{From: strings.TrimSpace(split[0]), To: strings.TrimSpace(split[1])}
+		if mirror.From == "" || mirror.To == "" {
+			return nil, fmt.Errorf("invalid source mirror: %s, expected format: FROM => TO", line)
+		}
+		if _, err := url.Parse(mirror.To); err != nil {
+			return nil, fmt.Errorf("invalid mirror url: %s, error: %s", mirror.To, err)
+		}
+
+		mirrors = append(mirrors, mirror)
+	}
+
+	return mirrors, nil
+}
+
+// mirrorURL returns the url rewritten by the first matching mirror.
+func mirrorURL(u string, mirrors []SourceMirror) (string, bool) {
+	for _, mirror := range mirrors {
+		if strings.HasPrefix(u, mirror.From) {
+			return mirror.To + strings.TrimPrefix(u, mirror.From), true
+		}
+	}
+	return u, false
+}
+
+// setupGitURLRewrites configures git (started by the step's child processes) to fetch from the mirrors,
+// using url.<base>.insteadOf configs. The committed Podfile is left untouched.
+func setupGitURLRewrites(mirrors []SourceMirror) error {
+	for _, mirror := range mirrors {
+		if err := appendGitConfigEnv(fmt.Sprintf("url.%s.insteadOf", mirror.To), mirror.From); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CDNSourceMirror is a mirrored CDN source, used through a temporary alias spec repo.
+type CDNSourceMirror struct {
+	URL    string `json:"url"`
+	Mirror string `json:"mirror"`
+	Alias  string `json:"alias"`
+	// LockfileKey is how the source is listed in the SPEC REPOS section of the Podfile.lock.
+	LockfileKey string `json:"lockfile_key"`
+}
+
+// cdnSourceMirrors returns the mirrored CDN sources: the local CDN repos and trunk, whether or not it is added yet.
+func cdnSourceMirrors(localRepos []LocalSpecRepo, mirrors []SourceMirror) []CDNSourceMirror {
+	repos := []LocalSpecRepo{{Name: trunkSpecRepoSource, URL: trunkCDNURL, IsCDN: true}}
+	for _, repo := range localRepos {
+		if repo.IsCDN && repo.Name != trunkSpecRepoSource && !strings.HasSuffix(repo.Name, cdnMirrorAliasSuffix) {
+			repos = append(repos, repo)
+		}
+	}
+
+	var cdnMirrors []CDNSourceMirror
+	for _, repo := range repos {
+		mirrored, ok := mirrorURL(repo.URL, mirrors)
+		if !ok {
+			continue
+		}
+
+		lockfileKey := strings.TrimSuffix(repo.URL, "/") + "/"
+		if repo.Name == trunkSpecRepoSource {
+			lockfileKey = trunkSpecRepoSource
+		}
+		cdnMirrors = append(cdnMirrors, CDNSourceMirror{
+			URL:         repo.URL,
+			Mirror:      strings.TrimSuffix(mirrored, "/") + "/",
+			Alias:       repo.Name + cdnMirrorAliasSuffix,
+			LockfileKey: lockfileKey,
+		})
+	}
+	return cdnMirrors
+}
+
+// gitSourceMirrors returns the mirrors which are not CDN source mirrors, only these are git url rewrites.
+func gitSourceMirrors(mirrors []SourceMirror, cdnMirrors []CDNSourceMirror) []SourceMirror {
+	var gitMirrors []SourceMirror
+	for _, mirror := range mirrors {
+		isCDN := false
+		for _, cdnMirror := range cdnMirrors {
+			if strings.HasPrefix(cdnMirror.URL, mirror.From) {
+				isCDN = true
+				break
+			}
+		}
+		if !isCDN {
+			gitMirrors = append(gitMirrors, mirror)
+		}
+	}
+	return gitMirrors
+}
+
+// setupCDNSpecRepoMirrors adds a temporary alias spec repo with the mirror url for every mirrored CDN source,
+// and preloads sourceMirrorsScript into the ruby processes, so CocoaPods uses the alias for the original url.
+// The original repos are not modified. The returned function removes the aliases.
+func setupCDNSpecRepoMirrors(cdnMirrors []CDNSourceMirror) (func(), error) {
+	if len(cdnMirrors) == 0 {
+		return func() {}, nil
+	}
+
+	var restoreFuncs []func() error
+	restore := func() {
+		for i := len(restoreFuncs) - 1; i >= 0; i-- {
+			if err := restoreFuncs[i](); err != nil {
+				log.Warnf("Failed to remove CDN spec repo mirror, error: %s", err)
+			}
+		}
+	}
+
+	for _, cdnMirror := range cdnMirrors {
+		// an alias left behind by a killed build is replaced
+		aliasDir := filepath.Join(specReposDir(), cdnMirror.Alias)
+		if err := os.RemoveAll(aliasDir); err != nil {
+			restore()
+			return nil, err
+		}
+		if err := pathutil.EnsureDirExist(aliasDir); err != nil {
+			restore()
+			return nil, err
+		}
+		restoreFuncs = append(restoreFuncs, func() error {
+			return os.RemoveAll(aliasDir)
+		})
+
+		if err := fileutil.WriteStringToFile(filepath.Join(aliasDir, ".url"), cdnMirror.Mirror); err != nil {
+			restore()
+			return nil, err
+		}
+
+		log.Printf("CDN spec repo mirrored by the %s alias repo: %s => %s", cdnMirror.Alias, cdnMirror.URL, cdnMirror.Mirror)
+	}
+
+	envs, cleanup, err := sourceMirrorsScriptEnvs(cdnMirrors, os.Getenv("RUBYOPT"))
+	if err != nil {
+		restore()
+		return nil, err
+	}
+	restoreFuncs = append(restoreFuncs, cleanup)
+
+	for _, env := range envs {
+		split := strings.SplitN(env, "=", 2)
+		key, value := split[0], split[1]
+
+		original, isSet := os.LookupEnv(key)
+		restoreFuncs = append(restoreFuncs, func() error {
+			if isSet {
+				return os.Setenv(key, original)
+			}
+			return os.Unsetenv(key)
+		})
+
+		if err := os.Setenv(key, value); err != nil {
+			restore()
+			return nil, err
+		}
+	}
+
+	return restore, nil
+}
+
+// sourceMirrorsScriptEnvs writes the preload script into a temporary dir, and returns the envs loading it into the ruby processes.
+func sourceMirrorsScriptEnvs(cdnMirrors []CDNSourceMirror, rubyOpt string) ([]string, func() error, error) {
+	content, err := json.Marshal(cdnMirrors)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tmpDir, err := pathutil.NormalizedOSTempDirPath("source_mirrors")
+	if err != nil {
+		return nil, nil, err
+	}
+	cleanup := func() error {
+		return os.RemoveAll(tmpDir)
+	}
+
+	scriptPth := filepath.Join(tmpDir, "cocoapods_source_mirrors.rb")
+	if err := fileutil.WriteStringToFile(scriptPth, sourceMirrorsScript); err != nil {
+		return nil, nil, err
+	}
+
+	return []string{
+		"COCOAPODS_SOURCE_MIRRORS=" + string(content),
+		"RUBYOPT=" + strings.TrimSpace("-r"+scriptPth+" "+rubyOpt),
+	}, cleanup, nil
+}
+
+// setupSourceMirrors rewrites the git sources with git configs, and mirrors the CDN sources through alias repos,
+// and returns the mirrored CDN sources. The returned function removes the CDN aliases.
+func setupSourceMirrors(mirrors []SourceMirror) ([]CDNSourceMirror, func(), error) {
+	if len(mirrors) == 0 {
+		return nil, func() {}, nil
+	}
+
+	fmt.Println()
+	log.Infof("Setting up source mirrors")
+
+	localRepos, err := listLocalSpecRepos()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list spec repos, error: %s", err)
+	}
+	cdnMirrors := cdnSourceMirrors(localRepos, mirrors)
+
+	if err := setupGitURLRewrites(gitSourceMirrors(mirrors, cdnMirrors)); err != nil {
+		return nil, nil, fmt.Errorf("failed to set up git url rewrites, error: %s", err)
+	}
+
+	restore, err := setupCDNSpecRepoMirrors(cdnMirrors)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to set up CDN spec repo mirrors, error: %s", err)
+	}
+	return cdnMirrors, restore, nil
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSourceMirrors(t *testing.T) {
+	t.Log("valid mirrors")
+	{
+		input := `https://cdn.cocoapods.org/ => https://pods-mirror.internal/
+# git hosts
+https://github.com/ => https://git-mirror.internal/github/`
+
+		mirrors, err := parseSourceMirrors(input)
+		require.NoError(t, err)
+		require.Equal(t, []SourceMirror{
+			{From: "https://cdn.cocoapods.org/", To: "https://pods-mirror.internal/"},
+			{From: "https://github.com/", To: "https://git-mirror.internal/github/"},
+		}, mirrors)
+	}
+
+	t.Log("missing mirror")
+	{
+		_, err := parseSourceMirrors("https://cdn.cocoapods.org/ =>")
+		require.Error(t, err)
+	}
+
+	t.Log("missing separator")
+	{
+		_, err := parseSourceMirrors("https://cdn.cocoapods.org/ https://pods-mirror.internal/")
+		require.Error(t, err)
+	}
+}
+
+func TestMirrorURL(t *testing.T) {
+	mirrors := []SourceMirror{
+		{From: "https://cdn.cocoapods.org/", To: "https://pods-mirror.internal/"},
+		{From: "https://github.com/", To: "https://git-mirror.internal/github/"},
+	}
+
+	u, ok := mirrorURL("https://github.com/my-org/specs.git", mirrors)
+	require.True(t, ok)
+	require.Equal(t, "https://git-mirror.internal/github/my-org/specs.git", u)
+
+	u, ok = mirrorURL("https://gitlab.com/my-org/specs.git", mirrors)
+	require.False(t, ok)
+	require.Equal(t, "https://gitlab.com/my-org/specs.git", u)
+}
+
+func TestCDNSourceMirrors(t *testing.T) {
+	mirrors := []SourceMirror{
+		{From: "https://cdn.cocoapods.org/", To: "https://pods-mirror.internal"},
+		{From: "https://cdn.my-org.com/", To: "https://cdn-mirror.internal/my-org/"},
+		{From: "https://github.com/", To: "https://git-mirror.internal/github/"},
+	}
+	localRepos := []LocalSpecRepo{
+		{Name: "trunk", URL: "https://cdn.cocoapods.org/", IsCDN: true},
+		{Name: "my-org", URL: "https://cdn.my-org.com/specs", IsCDN: true},
+		{Name: "my-org-mirror", URL: "https://cdn-mirror.internal/my-org/specs/", IsCDN: true},
+		{Name: "other", URL: "https://cdn.other.com/", IsCDN: true},
+		{Name: "git-specs", URL: "https://github.com/my-org/specs.git"},
+	}
+
+	cdnMirrors := cdnSourceMirrors(localRepos, mirrors)
+	require.Equal(t, []CDNSourceMirror{
+		{URL: "https://cdn.cocoapods.org/", Mirror: "https://pods-mirror.internal/", Alias: "trunk-mirror", LockfileKey: "trunk"},
+		{URL: "https://cdn.my-org.com/specs", Mirror: "https://cdn-mirror.internal/my-org/specs/", Alias: "my-org-mirror", LockfileKey: "https://cdn.my-org.com/specs/"},
+	}, cdnMirrors)
+
+	t.Log("trunk is mirrored before it is added")
+	{
+		require.Equal(t, "trunk-mirror", cdnSourceMirrors(nil, mirrors)[0].Alias)
+	}
+
+	t.Log("CDN mirrors are not git url rewrites")
+	{
+		require.Equal(t, []SourceMirror{{From: "https://github.com/", To: "https://git-mirror.internal/github/"}}, gitSourceMirrors(mirrors, cdnMirrors))
+	}
+}
+
+func TestSetupCDNSpecRepoMirrors(t *testing.T) {
+	reposDir, err := ioutil.TempDir("", "repos")
+	require.NoError(t, err)
+	defer func() { require.NoError(t, os.RemoveAll(reposDir)) }()
+
+	for key, value := range map[string]string{"CP_REPOS_DIR": reposDir, "RUBYOPT": "-W0"} {
+		original, isSet := os.LookupEnv(key)
+		require.NoError(t, os.Setenv(key, value))
+		defer func(key string) {
+			if isSet {
+				require.NoError(t, os.Setenv(key, original))
+			} else {
+				require.NoError(t, os.Unsetenv(key))
+			}
+		}(key)
+	}
+	require.NoError(t, os.Unsetenv("COCOAPODS_SOURCE_MIRRORS"))
+
+	trunkURLPth := filepath.Join(reposDir, "trunk", ".url")
+	require.NoError(t, os.MkdirAll(filepath.Dir(trunkURLPth), 0755))
+	require.NoError(t, ioutil.WriteFile(trunkURLPth, []byte(trunkCDNURL), 0644))
+
+	// left behind by a killed build
+	aliasURLPth := filepath.Join(reposDir, "trunk-mirror", ".url")
+	require.NoError(t, os.MkdirAll(filepath.Dir(aliasURLPth), 0755))
+	require.NoError(t, ioutil.WriteFile(aliasURLPth, []byte("https://old-mirror.internal/"), 0644))
+
+	cdnMirrors := []CDNSourceMirror{{URL: trunkCDNURL, Mirror: "https://pods-mirror.internal/", Alias: "trunk-mirror", LockfileKey: "trunk"}}
+	restore, err := setupCDNSpecRepoMirrors(cdnMirrors)
+	require.NoError(t, err)
+
+	t.Log("adds the alias repo and leaves trunk untouched")
+	{
+		content, err := ioutil.ReadFile(trunkURLPth)
+		require.NoError(t, err)
+		require.Equal(t, trunkCDNURL, string(content))
+
+		content, err = ioutil.ReadFile(aliasURLPth)
+		require.NoError(t, err)
+		require.Equal(t, "https://pods-mirror.internal/", string(content))
+	}
+
+	t.Log("preloads the redirect script")
+	{
+		rubyOpt := os.Getenv("RUBYOPT")
+		require.True(t, strings.HasPrefix(rubyOpt, "-r"))
+		require.True(t, strings.HasSuffix(rubyOpt, " -W0"))
+
+		scriptPth := strings.TrimPrefix(strings.TrimSuffix(rubyOpt, " -W0"), "-r")
+		content, err := ioutil.ReadFile(scriptPth)
+		require.NoError(t, err)
+		require.Equal(t, sourceMirrorsScript, string(content))
+
+		var envMirrors []CDNSourceMirror
+		require.NoError(t, json.Unmarshal([]byte(os.Getenv("COCOAPODS_SOURCE_MIRRORS")), &envMirrors))
+		require.Equal(t, cdnMirrors, envMirrors)
+
+		restore()
+
+		require.NoFileExists(t, scriptPth)
+	}
+
+	t.Log("restore removes the alias repo and the envs")
+	{
+		require.NoDirExists(t, filepath.Dir(aliasURLPth))
+		require.FileExists(t, trunkURLPth)
+		require.Equal(t, "-W0", os.Getenv("RUBYOPT"))
+		_, isSet := os.LookupEnv("COCOAPODS_SOURCE_MIRRORS")
+		require.False(t, isSet)
+	}
+}
+
+func TestSetupSourceMirrors(t *testing.T) {
+	t.Log("no mirrors")
+	{
+		cdnMirrors, restore, err := setupSourceMirrors(nil)
+		require.NoError(t, err)
+		require.Nil(t, cdnMirrors)
+		restore()
+	}
+
+	reposDir, err := ioutil.TempDir("", "repos")
+	require.NoError(t, err)
+	defer func() { require.NoError(t, os.RemoveAll(reposDir)) }()
+
+	for key, value := range map[string]string{"CP_REPOS_DIR": reposDir, "RUBYOPT": "", "GIT_CONFIG_COUNT": "", "COCOAPODS_SOURCE_MIRRORS": ""} {
+		original, isSet := os.LookupEnv(key)
+		require.NoError(t, os.Setenv(key, value))
+		defer func(key string) {
+			if isSet {
+				require.NoError(t, os.Setenv(key, original))
+			} else {
+				require.NoError(t, os.Unsetenv(key))
+			}
+		}(key)
+	}
+	defer func() {
+		require.NoError(t, os.Unsetenv("GIT_CONFIG_KEY_0"))
+		require.NoError(t, os.Unsetenv("GIT_CONFIG_VALUE_0"))
+	}()
+
+	cdnMirrors, restore, err := setupSourceMirrors([]SourceMirror{
+		{From: trunkCDNURL, To: "https://pods-mirror.internal/"},
+		{From: "https://github.com/", To: "https://git-mirror.internal/github/"},
+	})
+	require.NoError(t, err)
+
+	t.Log("mirrors trunk through an alias repo")
+	{
+		require.Equal(t, []CDNSourceMirror{{URL: trunkCDNURL, Mirror: "https://pods-mirror.internal/", Alias: "trunk-mirror", LockfileKey: "trunk"}}, cdnMirrors)
+		require.FileExists(t, filepath.Join(reposDir, "trunk-mirror", ".url"))
+	}
+
+	t.Log("rewrites the git sources")
+	{
+		require.Equal(t, "1", os.Getenv("GIT_CONFIG_COUNT"))
+		require.Equal(t, "url.https://git-mirror.internal/github/.insteadOf", os.Getenv("GIT_CONFIG_KEY_0"))
+		require.Equal(t, "https://github.com/", os.Getenv("GIT_CONFIG_VALUE_0"))
+	}
+
+	t.Log("restore removes the alias repo")
+	{
+		restore()
+		require.NoDirExists(t, filepath.Join(reposDir, "trunk-mirror"))
+	}
+}
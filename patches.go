@@ -0,0 +1,291 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/bitrise-io/go-utils/command"
+	"github.com/bitrise-io/go-utils/fileutil"
+	"github.com/bitrise-io/go-utils/log"
+)
+
+const (
+	podPatchExtension = ".patch"
+	// podPatchMarkerFileName is written into the patched pod's dir, CocoaPods removes it together with the dir when it reinstalls the pod.
+	podPatchMarkerFileName = ".cocoapods-patch"
+	// podsCacheIndicatorFileName changes if the Podfile.lock, any of the patches or the build setting rules change,
+	// so the patched and normalized Pods dir is re-cached.
+	podsCacheIndicatorFileName = ".cocoapods-cache-indicator"
+)
+
+// PodPatch is a patch file named <PodName>+<version>.patch.
+type PodPatch struct {
+	Pod      string
+	Version  string
+	Pth      string
+	Checksum string
+}
+
+// marker is the content of the marker file of the pod, identifying the applied patch.
+func (p PodPatch) marker() string {
+	return fmt.Sprintf("%s\n%s\n", filepath.Base(p.Pth), p.Checksum)
+}
+
+// parsePodPatchFileName splits a <PodName>+<version>.patch file name, the version is after the last +.
+func parsePodPatchFileName(name string) (string, string, error) {
+	if !strings.HasSuffix(name, podPatchExtension) {
+		return "", "", fmt.Errorf("%s is not a %s file", name, podPatchExtension)
+	}
+	base := strings.TrimSuffix(name, podPatchExtension)
+
+	idx := strings.LastIndex(base, "+")
+	if idx <= 0 || idx == len(base)-1 {
+		return "", "", fmt.Errorf("invalid patch file name: %s, expected format: <PodName>+<version>%s", name, podPatchExtension)
+	}
+	return base[:idx], base[idx+1:], nil
+}
+
+// listPodPatches returns the patches of the patches dir, sorted by file name.
+func listPodPatches(patchesDir string) ([]PodPatch, error) {
+	infos, err := ioutil.ReadDir(patchesDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var patches []PodPatch
+	pods := map[string]string{}
+	for _, info := range infos {
+		if info.IsDir() || !strings.HasSuffix(info.Name(), podPatchExtension) {
+			continue
+		}
+
+		pod, version, err := parsePodPatchFileName(info.Name())
+		if err != nil {
+			return nil, err
+		}
+		if other, ok := pods[pod]; ok {
+			return nil, fmt.Errorf("multiple patches found for pod (%s): %s, %s", pod, other, info.Name())
+		}
+		pods[pod] = info.Name()
+
+		pth := filepath.Join(patchesDir, info.Name())
+		content, err := ioutil.ReadFile(pth)
+		if err != nil {
+			return nil, err
+		}
+
+		patches = append(patches, PodPatch{Pod: pod, Version: version, Pth: pth, Checksum: fmt.Sprintf("%x", sha256.Sum256(content))})
+	}
+
+	sort.Slice(patches, func(i, j int) bool { return patches[i].Pod < patches[j].Pod })
+	return patches, nil
+}
+
+// - Alamofire (5.4.0)
+// - Firebase/Core (8.0.0):
+// - "GoogleUtilities/Environment (7.4.1)":
+var podfileLockPodExp = regexp.MustCompile(`^  - "?([^\s"(]+) \(([^)]+)\)"?:?$`)
+
+// parsePodfileLockPodVersions returns the versions of the root pods listed in the PODS section of the Podfile.lock.
+func parsePodfileLockPodVersions(content string) map[string]string {
+	versions := map[string]string{}
+	inSection := false
+
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimRight(line, "\r")
+
+		if line == "PODS:" {
+			inSection = true
+			continue
+		}
+		if !inSection {
+			continue
+		}
+		if !strings.HasPrefix(line, "  ") {
+			break
+		}
+
+		if match := podfileLockPodExp.FindStringSubmatch(line); match != nil {
+			pod := strings.SplitN(match[1], "/", 2)[0]
+			versions[pod] = match[2]
+		}
+	}
+
+	return versions
+}
+
+// verifyPodPatches checks that every patch is for the pod version locked in the Podfile.lock.
+func verifyPodPatches(patches []PodPatch, lockedVersions map[string]string) error {
+	for _, patch := range patches {
+		locked, ok := lockedVersions[patch.Pod]
+		if !ok {
+			return fmt.Errorf("%s is for pod %s, which is not in the Podfile.lock", filepath.Base(patch.Pth), patch.Pod)
+		}
+		if locked != patch.Version {
+			return fmt.Errorf("%s is for %s %s, but the Podfile.lock has %s %s, update the patch for the new version", filepath.Base(patch.Pth), patch.Pod, patch.Version, patch.Pod, locked)
+		}
+	}
+	return nil
+}
+
+func readPodPatchMarker(podDir string) string {
+	content, err := fileutil.ReadStringFromFile(filepath.Join(podDir, podPatchMarkerFileName))
+	if err != nil {
+		return ""
+	}
+	return content
+}
+
+// removeStalePatchedPods removes the pods (typically restored from the cache) patched with a different or removed patch,
+// so that pod install reinstalls them unpatched, and returns whether any pod was removed.
+func removeStalePatchedPods(podsDir string, patches []PodPatch) (bool, error) {
+	markers, err := filepath.Glob(filepath.Join(podsDir, "*", podPatchMarkerFileName))
+	if err != nil {
+		return false, err
+	}
+
+	wanted := map[string]string{}
+	for _, patch := range patches {
+		wanted[patch.Pod] = patch.marker()
+	}
+
+	removed := false
+	for _, markerPth := range markers {
+		podDir := filepath.Dir(markerPth)
+		if readPodPatchMarker(podDir) == wanted[filepath.Base(podDir)] {
+			continue
+		}
+
+		log.Warnf("%s was patched with a different patch, removing it to reinstall it", podDir)
+		if err := os.RemoveAll(podDir); err != nil {
+			return false, err
+		}
+		removed = true
+	}
+
+	return removed, nil
+}
+
+// applyPodPatch applies the patch to the pod's dir, unless the marker shows it is already applied.
+// The patch is checked with a dry run first, so a rejected patch does not leave the pod half patched.
+func applyPodPatch(podsDir string, patch PodPatch) (bool, error) {
+	podDir := filepath.Join(podsDir, patch.Pod)
+	if !isPathExists(podDir) {
+		return false, fmt.Errorf("%s is for pod %s, which is not installed into %s (pods from a :path source can not be patched)", filepath.Base(patch.Pth), patch.Pod, podsDir)
+	}
+
+	if readPodPatchMarker(podDir) == patch.marker() {
+		return false, nil
+	}
+
+	for _, dryRun := range []bool{true, false} {
+		args := []string{"-p1", "--forward", "--batch", "-d", podDir, "-i", patch.Pth}
+		if dryRun {
+			args = append(args, "--dry-run")
+		}
+
+		var output bytes.Buffer
+		cmd := command.New("patch", args...)
+		cmd.SetStdout(&output).SetStderr(&output)
+
+		if err := runCommand(cmd); err != nil {
+			return false, fmt.Errorf("%s does not apply to %s: %s\n%s", filepath.Base(patch.Pth), podDir, err, strings.TrimSpace(output.String()))
+		}
+	}
+
+	if err := fileutil.WriteStringToFile(filepath.Join(podDir, podPatchMarkerFileName), patch.marker()); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// podsCacheIndicator is the content of the cache indicator: the checksum of the Podfile.lock and the patches, and the build setting rules.
+func podsCacheIndicator(podfileLockContent string, patches []PodPatch, rules []BuildSettingRule) string {
+	lines := []string{fmt.Sprintf("Podfile.lock %x", sha256.Sum256([]byte(podfileLockContent)))}
+	for _, patch := range patches {
+		lines = append(lines, fmt.Sprintf("%s %s", filepath.Base(patch.Pth), patch.Checksum))
+	}
+	for _, rule := range rules {
+		lines = append(lines, fmt.Sprintf("build setting %s", rule))
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// preparePodPatches lists the patches of the patches dir (relative to the Podfile's dir), and removes the stale patched pods,
+// and returns whether any pod was removed. The stale pods are removed if the patches dir is not set too,
+// so the pods patched by an earlier build are reinstalled after the pods_patches_dir input is cleared.
+func preparePodPatches(patchesDir, podfileDir, podsDir string) ([]PodPatch, bool, error) {
+	var patches []PodPatch
+	if patchesDir != "" {
+		if !filepath.IsAbs(patchesDir) {
+			patchesDir = filepath.Join(podfileDir, patchesDir)
+		}
+
+		var err error
+		if patches, err = listPodPatches(patchesDir); err != nil {
+			return nil, false, fmt.Errorf("failed to list pod patches in %s, error: %s", patchesDir, err)
+		}
+	}
+
+	removed, err := removeStalePatchedPods(podsDir, patches)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to remove stale patched pods, error: %s", err)
+	}
+	return patches, removed, nil
+}
+
+// applyPodPatches applies the patches to the installed pods.
+func applyPodPatches(podsDir, podfileLockPth string, patches []PodPatch) error {
+	if len(patches) == 0 {
+		return nil
+	}
+
+	fmt.Println()
+	log.Infof("Applying pod patches")
+
+	content, err := fileutil.ReadStringFromFile(podfileLockPth)
+	if err != nil {
+		return err
+	}
+
+	if err := verifyPodPatches(patches, parsePodfileLockPodVersions(content)); err != nil {
+		return err
+	}
+
+	for _, patch := range patches {
+		applied, err := applyPodPatch(podsDir, patch)
+		if err != nil {
+			return err
+		}
+		if applied {
+			log.Donef("Applied %s", filepath.Base(patch.Pth))
+		} else {
+			log.Printf("%s already applied", filepath.Base(patch.Pth))
+		}
+	}
+
+	return nil
+}
+
+// writePodsCacheIndicator writes the cache indicator of the patched and normalized Pods dir into the Pods dir, and returns its path.
+// The cache is pushed again if the indicator's content differs from the one restored with the Pods dir,
+// so a changed, added or removed patch or build setting rule re-caches the Pods dir even if the Podfile.lock did not change.
+func writePodsCacheIndicator(podsDir, podfileLockPth string, patches []PodPatch, rules []BuildSettingRule) (string, error) {
+	content, err := fileutil.ReadStringFromFile(podfileLockPth)
+	if err != nil {
+		return "", err
+	}
+
+	indicatorPth := filepath.Join(podsDir, podsCacheIndicatorFileName)
+	if err := fileutil.WriteStringToFile(indicatorPth, podsCacheIndicator(content, patches, rules)); err != nil {
+		return "", err
+	}
+	return indicatorPth, nil
+}
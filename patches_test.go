@@ -0,0 +1,224 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testPodPatch = `--- a/Source/Session.swift
++++ b/Source/Session.swift
+@@ -1,3 +1,3 @@
+ import Foundation
+-let timeout = 60
++let timeout = 120
+ // end
+`
+
+func TestParsePodPatchFileName(t *testing.T) {
+	pod, version, err := parsePodPatchFileName("Alamofire+5.4.0.patch")
+	require.NoError(t, err)
+	require.Equal(t, "Alamofire", pod)
+	require.Equal(t, "5.4.0", version)
+
+	pod, version, err = parsePodPatchFileName("Some+Pod+1.0.0-beta.1.patch")
+	require.NoError(t, err)
+	require.Equal(t, "Some+Pod", pod)
+	require.Equal(t, "1.0.0-beta.1", version)
+
+	for _, name := range []string{"Alamofire.patch", "+5.4.0.patch", "Alamofire+.patch", "Alamofire+5.4.0.diff"} {
+		_, _, err := parsePodPatchFileName(name)
+		require.Error(t, err, name)
+	}
+}
+
+func TestParsePodfileLockPodVersions(t *testing.T) {
+	content := `PODS:
+  - Alamofire (5.4.0)
+  - Firebase/Core (8.0.0):
+    - FirebaseAnalytics (= 8.0.0)
+  - "GoogleUtilities/Environment (7.4.1)":
+    - PromisesObjC (~> 1.2)
+
+DEPENDENCIES:
+  - Alamofire (~> 5.4)
+`
+	require.Equal(t, map[string]string{
+		"Alamofire":       "5.4.0",
+		"Firebase":        "8.0.0",
+		"GoogleUtilities": "7.4.1",
+	}, parsePodfileLockPodVersions(content))
+}
+
+func TestVerifyPodPatches(t *testing.T) {
+	locked := map[string]string{"Alamofire": "5.4.0"}
+
+	require.NoError(t, verifyPodPatches([]PodPatch{{Pod: "Alamofire", Version: "5.4.0", Pth: "Alamofire+5.4.0.patch"}}, locked))
+	require.EqualError(t, verifyPodPatches([]PodPatch{{Pod: "Alamofire", Version: "5.3.0", Pth: "Alamofire+5.3.0.patch"}}, locked),
+		"Alamofire+5.3.0.patch is for Alamofire 5.3.0, but the Podfile.lock has Alamofire 5.4.0, update the patch for the new version")
+	require.Error(t, verifyPodPatches([]PodPatch{{Pod: "Moya", Version: "15.0.0", Pth: "Moya+15.0.0.patch"}}, locked))
+}
+
+func TestPodsCacheIndicator(t *testing.T) {
+	patches := []PodPatch{{Pod: "Alamofire", Pth: "/patches/Alamofire+5.4.0.patch", Checksum: "abc"}}
+	rules := []BuildSettingRule{{Key: "IPHONEOS_DEPLOYMENT_TARGET", Kind: BuildSettingRuleFloor, Value: "12.0"}}
+	indicator := podsCacheIndicator("PODS:\n", patches, rules)
+	require.Contains(t, indicator, "Alamofire+5.4.0.patch abc\n")
+	require.Contains(t, indicator, "build setting IPHONEOS_DEPLOYMENT_TARGET>=12.0\n")
+	require.NotEqual(t, indicator, podsCacheIndicator("PODS:\n", []PodPatch{{Pod: "Alamofire", Pth: "/patches/Alamofire+5.4.0.patch", Checksum: "def"}}, rules))
+	require.NotEqual(t, indicator, podsCacheIndicator("PODS:\n  - Alamofire (5.4.0)\n", patches, rules))
+	require.NotEqual(t, indicator, podsCacheIndicator("PODS:\n", patches, []BuildSettingRule{{Key: "IPHONEOS_DEPLOYMENT_TARGET", Kind: BuildSettingRuleFloor, Value: "13.0"}}))
+	require.NotEqual(t, indicator, podsCacheIndicator("PODS:\n", patches, nil))
+}
+
+func TestApplyPodPatches(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "patches")
+	require.NoError(t, err)
+	defer func() { require.NoError(t, os.RemoveAll(tmpDir)) }()
+
+	patchesDir := filepath.Join(tmpDir, "patches")
+	podsDir := filepath.Join(tmpDir, "Pods")
+	sourcePth := filepath.Join(podsDir, "Alamofire", "Source", "Session.swift")
+	podfileLockPth := filepath.Join(tmpDir, "Podfile.lock")
+
+	require.NoError(t, os.MkdirAll(patchesDir, 0755))
+	require.NoError(t, os.MkdirAll(filepath.Dir(sourcePth), 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(patchesDir, "Alamofire+5.4.0.patch"), []byte(testPodPatch), 0644))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(patchesDir, "README.md"), []byte("patches"), 0644))
+	require.NoError(t, ioutil.WriteFile(sourcePth, []byte("import Foundation\nlet timeout = 60\n// end\n"), 0644))
+	require.NoError(t, ioutil.WriteFile(podfileLockPth, []byte("PODS:\n  - Alamofire (5.4.0)\n"), 0644))
+
+	patches, err := listPodPatches(patchesDir)
+	require.NoError(t, err)
+	require.Equal(t, 1, len(patches))
+	require.Equal(t, "Alamofire", patches[0].Pod)
+
+	t.Log("applies the patch")
+	{
+		require.NoError(t, applyPodPatches(podsDir, podfileLockPth, patches))
+
+		content, err := ioutil.ReadFile(sourcePth)
+		require.NoError(t, err)
+		require.Equal(t, "import Foundation\nlet timeout = 120\n// end\n", string(content))
+	}
+
+	t.Log("does not re-apply an applied patch")
+	{
+		applied, err := applyPodPatch(podsDir, patches[0])
+		require.NoError(t, err)
+		require.False(t, applied)
+	}
+
+	t.Log("keeps the pod patched with the same patch")
+	{
+		removed, err := removeStalePatchedPods(podsDir, patches)
+		require.NoError(t, err)
+		require.False(t, removed)
+		require.True(t, isPathExists(sourcePth))
+	}
+
+	t.Log("removes the pod patched with a removed patch")
+	{
+		removed, err := removeStalePatchedPods(podsDir, nil)
+		require.NoError(t, err)
+		require.True(t, removed)
+		require.False(t, isPathExists(filepath.Join(podsDir, "Alamofire")))
+	}
+
+	t.Log("fails on a rejected patch")
+	{
+		require.NoError(t, os.MkdirAll(filepath.Dir(sourcePth), 0755))
+		require.NoError(t, ioutil.WriteFile(sourcePth, []byte("import Foundation\nlet timeout = 30\n// end\n"), 0644))
+
+		require.Error(t, applyPodPatches(podsDir, podfileLockPth, patches))
+
+		content, err := ioutil.ReadFile(sourcePth)
+		require.NoError(t, err)
+		require.Equal(t, "import Foundation\nlet timeout = 30\n// end\n", string(content))
+	}
+}
+
+func TestPreparePodPatches(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "patches")
+	require.NoError(t, err)
+	defer func() { require.NoError(t, os.RemoveAll(tmpDir)) }()
+
+	podsDir := filepath.Join(tmpDir, "Pods")
+	podDir := filepath.Join(podsDir, "Alamofire")
+	require.NoError(t, os.MkdirAll(podDir, 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(podDir, podPatchMarkerFileName), []byte("Alamofire+5.4.0.patch\nabc\n"), 0644))
+
+	t.Log("fails on a missing patches dir")
+	{
+		_, _, err := preparePodPatches("patches", tmpDir, podsDir)
+		require.Error(t, err)
+		require.True(t, isPathExists(podDir))
+	}
+
+	t.Log("removes the patched pods without a patches dir")
+	{
+		patches, removed, err := preparePodPatches("", tmpDir, podsDir)
+		require.NoError(t, err)
+		require.Nil(t, patches)
+		require.True(t, removed)
+		require.False(t, isPathExists(podDir))
+	}
+}
+
+func TestWritePodsCacheIndicator(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "patches")
+	require.NoError(t, err)
+	defer func() { require.NoError(t, os.RemoveAll(tmpDir)) }()
+
+	patchesDir := filepath.Join(tmpDir, "patches")
+	patchPth := filepath.Join(patchesDir, "Alamofire+5.4.0.patch")
+	podsDir := filepath.Join(tmpDir, "Pods")
+	sourcePth := filepath.Join(podsDir, "Alamofire", "Source", "Session.swift")
+	podfileLockPth := filepath.Join(tmpDir, "Podfile.lock")
+
+	require.NoError(t, os.MkdirAll(patchesDir, 0755))
+	require.NoError(t, ioutil.WriteFile(podfileLockPth, []byte("PODS:\n  - Alamofire (5.4.0)\n"), 0644))
+
+	// install simulates a build: the stale patched pods are removed, pod install reinstalls them, then the patches are applied.
+	install := func(patch string) (string, string) {
+		require.NoError(t, ioutil.WriteFile(patchPth, []byte(patch), 0644))
+		patches, _, err := preparePodPatches("patches", tmpDir, podsDir)
+		require.NoError(t, err)
+		if !isPathExists(sourcePth) {
+			require.NoError(t, os.MkdirAll(filepath.Dir(sourcePth), 0755))
+			require.NoError(t, ioutil.WriteFile(sourcePth, []byte("import Foundation\nlet timeout = 60\n// end\n"), 0644))
+		}
+		require.NoError(t, applyPodPatches(podsDir, podfileLockPth, patches))
+
+		indicatorPth, err := writePodsCacheIndicator(podsDir, podfileLockPth, patches, nil)
+		require.NoError(t, err)
+		content, err := ioutil.ReadFile(indicatorPth)
+		require.NoError(t, err)
+		return indicatorPth, string(content)
+	}
+
+	t.Log("the indicator is in the Pods dir")
+	indicatorPth, indicator := install(testPodPatch)
+	require.Equal(t, filepath.Join(podsDir, podsCacheIndicatorFileName), indicatorPth)
+
+	t.Log("the indicator does not change if nothing changed")
+	{
+		_, unchanged := install(testPodPatch)
+		require.Equal(t, indicator, unchanged)
+	}
+
+	t.Log("the indicator changes if only the patch changed")
+	{
+		changedPatchPth, changed := install(strings.Replace(testPodPatch, "timeout = 120", "timeout = 90", 1))
+		require.Equal(t, indicatorPth, changedPatchPth)
+		require.NotEqual(t, indicator, changed)
+
+		content, err := ioutil.ReadFile(sourcePth)
+		require.NoError(t, err)
+		require.Equal(t, "import Foundation\nlet timeout = 90\n// end\n", string(content))
+	}
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/bitrise-io/go-steputils/command/rubyscript"
+	"github.com/bitrise-io/go-utils/command"
+	"github.com/bitrise-io/go-utils/fileutil"
+	"github.com/bitrise-io/go-utils/log"
+)
+
+// PodfilePluginPin is a plugin gem version set by the podfile_plugin_versions input.
+type PodfilePluginPin struct {
+	Name    string
+	Version string
+}
+
+// podfilePluginsScript evaluates the Podfile with cocoapods-core, and prints the declared plugins as a JSON array.
+// Declaring a plugin does not load it, so the Podfile can be evaluated without the plugins installed.
+const podfilePluginsScript = `require 'json'
+
+version = ENV['COCOAPODS_CORE_VERSION'].to_s
+gem 'cocoapods-core', version unless version.empty?
+require 'cocoapods-core'
+
+podfile = Pod::Podfile.from_file(ENV['PODFILE_PATH'])
+puts podfile.plugins.keys.to_json
+`
+
+// plugin 'cocoapods-keys', {
+// plugin "cocoapods-binary"
+var podfilePluginExp = regexp.MustCompile(`^\s*plugin[\s(]+['"]([^'"]+)['"]`)
+
+// parsePodfilePlugins returns the plugins declared in the Podfile content, without evaluating it.
+func parsePodfilePlugins(content string) []string {
+	var plugins []string
+	seen := map[string]bool{}
+
+	for _, line := range strings.Split(content, "\n") {
+		if idx := strings.Index(line, "#"); idx != -1 {
+			line = line[:idx]
+		}
+
+		match := podfilePluginExp.FindStringSubmatch(line)
+		if match == nil || seen[match[1]] {
+			continue
+		}
+		seen[match[1]] = true
+		plugins = append(plugins, match[1])
+	}
+
+	return plugins
+}
+
+// podfilePluginsCommand returns the command evaluating the Podfile with cocoapods-core, run in the Podfile's dir with the pod envs.
+func podfilePluginsCommand(podfilePth, cocoapodsVersion string, envs []string) (*command.Model, error) {
+	helper := rubyscript.New(podfilePluginsScript)
+	cmd, err := helper.RunScriptCommand()
+	if err != nil {
+		return nil, err
+	}
+
+	cmd.SetDir(filepath.Dir(podfilePth))
+	// AppendEnvs replaces the previously appended envs, so they are appended at once
+	cmd.AppendEnvs(append(append([]string{}, envs...), "PODFILE_PATH="+podfilePth, "COCOAPODS_CORE_VERSION="+cocoapodsVersion)...)
+	return cmd, nil
+}
+
+// evaluatePodfilePlugins returns the plugins declared in the Podfile, by evaluating it with cocoapods-core.
+func evaluatePodfilePlugins(podfilePth, cocoapodsVersion string, envs []string) ([]string, error) {
+	cmd, err := podfilePluginsCommand(podfilePth, cocoapodsVersion, envs)
+	if err != nil {
+		return nil, err
+	}
+
+	var output bytes.Buffer
+	cmd.SetStdout(&output).SetStderr(&output)
+
+	if err := runCommand(cmd); err != nil {
+		return nil, fmt.Errorf("%s: %s", strings.TrimSpace(output.String()), err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+	var plugins []string
+	if err := json.Unmarshal([]byte(lines[len(lines)-1]), &plugins); err != nil {
+		return nil, fmt.Errorf("failed to parse plugins from output: %s, error: %s", output.String(), err)
+	}
+	sort.Strings(plugins)
+
+	return plugins, nil
+}
+
+// parsePodfilePluginPins parses the podfile_plugin_versions input, one pin per line in NAME VERSION format.
+func parsePodfilePluginPins(input string) ([]PodfilePluginPin, error) {
+	var pins []PodfilePluginPin
+	names := map[string]bool{}
+
+	for _, line := range strings.Split(input, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("invalid plugin version: %s, expected format: NAME VERSION", line)
+		}
+		if _, err := compareVersions(fields[1], "0"); err != nil {
+			return nil, fmt.Errorf("invalid plugin version: %s, %s", line, err)
+		}
+
+		pin := PodfilePluginPin{Name: fields[0], Version: fields[1]}
+		if names[pin.Name] {
+			return nil, fmt.Errorf("plugin (%s) pinned multiple times", pin.Name)
+		}
+		names[pin.Name] = true
+
+		pins = append(pins, pin)
+	}
+
+	return pins, nil
+}
+
+func podfilePluginVersion(name string, pins []PodfilePluginPin) string {
+	for _, pin := range pins {
+		if pin.Name == name {
+			return pin.Version
+		}
+	}
+	return ""
+}
+
+// gemDirVersions returns the versions of the gem installed in the gem dir.
+func gemDirVersions(gemDir, gem string) ([]string, error) {
+	specs, err := ioutil.ReadDir(filepath.Join(gemDir, "specifications"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var versions []string
+	prefix := gem + "-"
+	for _, spec := range specs {
+		name := strings.TrimSuffix(spec.Name(), ".gemspec")
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		// cocoapods-keys-2.2.1, but not cocoapods-keys-extension-1.0.0
+		if version := strings.TrimPrefix(name, prefix); versionExp.MatchString(version) {
+			versions = append(versions, version)
+		}
+	}
+	return versions, nil
+}
+
+// isPluginInstalled checks if the plugin gem (in the given version if not empty) is installed in the gem dir, or in the gem paths if gemDir is empty.
+func isPluginInstalled(gemDir, plugin, version string) (bool, error) {
+	var versions []string
+	if gemDir != "" {
+		var err error
+		if versions, err = gemDirVersions(gemDir, plugin); err != nil {
+			return false, err
+		}
+	} else {
+		out, err := command.New("gem", "list", "--exact", plugin).RunAndReturnTrimmedCombinedOutput()
+		if err != nil {
+			return false, fmt.Errorf("%s: %s", out, err)
+		}
+		versions = parseGemListVersions(out, plugin)
+	}
+
+	if version == "" {
+		return len(versions) > 0, nil
+	}
+	for _, installed := range versions {
+		if installed == version {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// installPodfilePlugins installs the plugin gems which are not installed yet, next to CocoaPods:
+// into the isolated gem dir if it is set, otherwise according to the gem install mode.
+func installPodfilePlugins(plugins []string, pins []PodfilePluginPin, mode GemInstallMode, gemDir string, source GemSource, dir string) error {
+	for _, plugin := range plugins {
+		version := podfilePluginVersion(plugin, pins)
+
+		installed, err := isPluginInstalled(gemDir, plugin, version)
+		if err != nil {
+			return fmt.Errorf("failed to check if plugin (%s) is installed, error: %s", plugin, err)
+		}
+		if installed {
+			log.Printf("Plugin %s %s installed", plugin, version)
+			continue
+		}
+
+		var slice []string
+		if gemDir != "" {
+			slice, err = isolatedGemInstallCmdSlice(gemDir, plugin, version, isPrereleaseVersion(version), source)
+		} else {
+			slice, err = gemInstallCmdSlice(plugin, version, isPrereleaseVersion(version), source)
+			slice = gemInstallModeCmdSlice(mode, slice)
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := runGemCommandWithRetry(func() (*command.Model, error) {
+			cmd, err := command.NewFromSlice(slice)
+			if err != nil {
+				return nil, err
+			}
+			if gemDir != "" {
+				cmd.AppendEnvs(isolatedGemEnvs(gemDir)...)
+			}
+			return cmd, nil
+		}, dir); err != nil {
+			return fmt.Errorf("failed to install plugin (%s), error: %s", plugin, err)
+		}
+	}
+
+	return nil
+}
+
+// checkPodfilePlugins installs the plugins declared in the Podfile, which are not installed yet.
+// The Podfile is evaluated with CocoaPods, or parsed if it can not be evaluated.
+func checkPodfilePlugins(podfilePth, cocoapodsVersion string, envs []string, pins []PodfilePluginPin, mode GemInstallMode, gemDir string, source GemSource) error {
+	content, err := fileutil.ReadStringFromFile(podfilePth)
+	if err != nil {
+		return fmt.Errorf("failed to read file (%s) contents, error: %s", podfilePth, err)
+	}
+
+	if !strings.Contains(content, "plugin") {
+		return nil
+	}
+
+	fmt.Println()
+	log.Infof("Checking Podfile plugins")
+
+	plugins, err := evaluatePodfilePlugins(podfilePth, cocoapodsVersion, envs)
+	if err != nil {
+		log.Warnf("Failed to evaluate Podfile, parsing it instead, error: %s", err)
+		plugins = parsePodfilePlugins(content)
+	}
+
+	if len(plugins) == 0 {
+		log.Printf("No plugins declared")
+		return nil
+	}
+
+	log.Printf("Plugins: %s", strings.Join(plugins, ", "))
+
+	if mode == "" {
+		gemEnv, err := gemEnvironment()
+		if err != nil {
+			return fmt.Errorf("failed to get gem environment, error: %s", err)
+		}
+		mode = gemInstallMode(gemEnv, "")
+	}
+
+	return installPodfilePlugins(plugins, pins, mode, gemDir, source, filepath.Dir(podfilePth))
+}
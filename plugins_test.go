@@ -0,0 +1,119 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPodfilePluginsCommand(t *testing.T) {
+	cmd, err := podfilePluginsCommand("/project/ios/Podfile", "1.11.3", []string{"CP_HOME_DIR=/tmp/cocoapods", "GEM_HOME=/tmp/gems"})
+	require.NoError(t, err)
+
+	execCmd := cmd.GetCmd()
+	require.Equal(t, "/project/ios", execCmd.Dir)
+	require.Subset(t, execCmd.Env, []string{
+		"CP_HOME_DIR=/tmp/cocoapods",
+		"GEM_HOME=/tmp/gems",
+		"PODFILE_PATH=/project/ios/Podfile",
+		"COCOAPODS_CORE_VERSION=1.11.3",
+	})
+}
+
+func TestParsePodfilePlugins(t *testing.T) {
+	content := `platform :ios, '13.0'
+
+plugin 'cocoapods-keys', {
+  :project => "MyApp",
+  :keys => ["APIKey"]
+}
+plugin "cocoapods-binary"
+# plugin 'cocoapods-disabled'
+plugin('cocoapods-acknowledgements')
+plugin 'cocoapods-binary'
+
+target 'MyApp' do
+  pod 'Alamofire' # plugin 'not-a-plugin'
+end
+`
+
+	require.Equal(t, []string{"cocoapods-keys", "cocoapods-binary", "cocoapods-acknowledgements"}, parsePodfilePlugins(content))
+	require.Nil(t, parsePodfilePlugins("target 'MyApp' do\nend\n"))
+}
+
+func TestParsePodfilePluginPins(t *testing.T) {
+	t.Log("valid pins")
+	{
+		pins, err := parsePodfilePluginPins("cocoapods-keys 2.2.1\n\n# comment\ncocoapods-binary 0.4.4.beta.1\n")
+		require.NoError(t, err)
+		require.Equal(t, []PodfilePluginPin{
+			{Name: "cocoapods-keys", Version: "2.2.1"},
+			{Name: "cocoapods-binary", Version: "0.4.4.beta.1"},
+		}, pins)
+		require.Equal(t, "2.2.1", podfilePluginVersion("cocoapods-keys", pins))
+		require.Equal(t, "", podfilePluginVersion("cocoapods-acknowledgements", pins))
+	}
+
+	t.Log("invalid pins")
+	{
+		_, err := parsePodfilePluginPins("cocoapods-keys")
+		require.Error(t, err)
+
+		_, err = parsePodfilePluginPins("cocoapods-keys latest")
+		require.Error(t, err)
+
+		_, err = parsePodfilePluginPins("cocoapods-keys 2.2.1\ncocoapods-keys 2.2.0")
+		require.Error(t, err)
+	}
+}
+
+func TestIsPluginInstalledInGemDir(t *testing.T) {
+	gemDir, err := ioutil.TempDir("", "gems")
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, os.RemoveAll(gemDir))
+	}()
+
+	installed, err := isPluginInstalled(gemDir, "cocoapods-keys", "")
+	require.NoError(t, err)
+	require.False(t, installed)
+
+	specsDir := filepath.Join(gemDir, "specifications")
+	require.NoError(t, os.MkdirAll(specsDir, 0755))
+	for _, spec := range []string{"cocoapods-keys-2.2.1.gemspec", "cocoapods-keys-extension-1.0.0.gemspec"} {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(specsDir, spec), []byte(""), 0644))
+	}
+
+	versions, err := gemDirVersions(gemDir, "cocoapods-keys")
+	require.NoError(t, err)
+	require.Equal(t, []string{"2.2.1"}, versions)
+
+	installed, err = isPluginInstalled(gemDir, "cocoapods-keys", "")
+	require.NoError(t, err)
+	require.True(t, installed)
+
+	installed, err = isPluginInstalled(gemDir, "cocoapods-keys", "2.2.0")
+	require.NoError(t, err)
+	require.False(t, installed)
+}
+
+func TestCheckPodfilePlugins(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "plugins")
+	require.NoError(t, err)
+	defer func() { require.NoError(t, os.RemoveAll(tmpDir)) }()
+
+	t.Log("fails without a Podfile")
+	{
+		require.Error(t, checkPodfilePlugins(filepath.Join(tmpDir, "missing", "Podfile"), "1.11.2", nil, nil, "", "", GemSource{}))
+	}
+
+	t.Log("does nothing if the Podfile declares no plugin")
+	{
+		podfilePth := filepath.Join(tmpDir, "Podfile")
+		require.NoError(t, ioutil.WriteFile(podfilePth, []byte("platform :ios, '12.0'\ntarget 'App' do\n  pod 'Alamofire'\nend\n"), 0644))
+		require.NoError(t, checkPodfilePlugins(podfilePth, "1.11.2", nil, nil, "", "", GemSource{}))
+	}
+}
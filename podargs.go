@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/bitrise-io/go-utils/sliceutil"
+)
+
+var envKeyExp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// parsePodEnvs parses the pod_env input: KEY=VALUE pairs separated by whitespace or newlines, values can be quoted.
+func parsePodEnvs(input string) ([]string, error) {
+	words, err := splitShellWords(input)
+	if err != nil {
+		return nil, err
+	}
+
+	var envs []string
+	for _, word := range words {
+		split := strings.SplitN(word, "=", 2)
+		if len(split) != 2 || !envKeyExp.MatchString(split[0]) {
+			return nil, fmt.Errorf("invalid env: %s, expected format: KEY=VALUE", word)
+		}
+		envs = append(envs, word)
+	}
+
+	return envs, nil
+}
+
+// podInstallFlagMinVersions lists the pod install flags and the first CocoaPods version supporting them.
+var podInstallFlagMinVersions = map[string]string{
+	"--repo-update":       "1.0.0",
+	"--no-repo-update":    "1.0.0",
+	"--verbose":           "1.0.0",
+	"--silent":            "1.0.0",
+	"--ansi":              "1.0.0",
+	"--no-ansi":           "1.0.0",
+	"--project-directory": "1.0.0",
+	"--deployment":        "1.6.0",
+	"--clean-install":     "1.7.0",
+	"--allow-root":        "1.10.0",
+}
+
+// validatePodInstallArgs checks if the resolved CocoaPods version supports the given pod install flags.
+// Unknown flags (for example flags added by plugins) are returned as warnings.
+func validatePodInstallArgs(args []string, cocoapodsVersion string) (warnings []string, err error) {
+	for _, arg := range args {
+		if !strings.HasPrefix(arg, "--") {
+			return nil, fmt.Errorf("unexpected argument: %s, only flags are supported", arg)
+		}
+
+		flag := strings.SplitN(arg, "=", 2)[0]
+		minVersion, ok := podInstallFlagMinVersions[flag]
+		if !ok {
+			warnings = append(warnings, fmt.Sprintf("unknown pod install flag: %s", flag))
+			continue
+		}
+
+		if cocoapodsVersion == "" {
+			continue
+		}
+
+		if cmp, err := compareVersions(cocoapodsVersion, minVersion); err != nil {
+			return nil, err
+		} else if cmp < 0 {
+			return nil, fmt.Errorf("%s requires CocoaPods %s or newer, the resolved version is %s", flag, minVersion, cocoapodsVersion)
+		}
+	}
+
+	return warnings, nil
+}
+
+// podInstallCmdSlice returns the pod install command with the step managed and the user provided flags.
+func podInstallCmdSlice(podCmdSlice []string, noRepoUpdate, verbose bool, args []string) []string {
+	slice := append(append([]string{}, podCmdSlice...), "install")
+	if noRepoUpdate && !sliceutil.IsStringInSlice("--repo-update", args) {
+		slice = append(slice, "--no-repo-update")
+	}
+	if verbose && !sliceutil.IsStringInSlice("--verbose", args) {
+		slice = append(slice, "--verbose")
+	}
+	return append(slice, args...)
+}
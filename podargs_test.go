@@ -0,0 +1,62 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePodEnvs(t *testing.T) {
+	t.Log("valid envs")
+	{
+		envs, err := parsePodEnvs("RCT_NEW_ARCH_ENABLED=1\nUSE_FRAMEWORKS=static COCOAPODS_DISABLE_STATS=true\nNAME=\"with space\"")
+		require.NoError(t, err)
+		require.Equal(t, []string{"RCT_NEW_ARCH_ENABLED=1", "USE_FRAMEWORKS=static", "COCOAPODS_DISABLE_STATS=true", "NAME=with space"}, envs)
+	}
+
+	t.Log("missing value")
+	{
+		_, err := parsePodEnvs("RCT_NEW_ARCH_ENABLED")
+		require.Error(t, err)
+	}
+
+	t.Log("invalid key")
+	{
+		_, err := parsePodEnvs("1KEY=value")
+		require.Error(t, err)
+	}
+}
+
+func TestValidatePodInstallArgs(t *testing.T) {
+	t.Log("supported flags")
+	{
+		warnings, err := validatePodInstallArgs([]string{"--clean-install", "--repo-update"}, "1.10.1")
+		require.NoError(t, err)
+		require.Equal(t, 0, len(warnings))
+	}
+
+	t.Log("flag requires newer version")
+	{
+		_, err := validatePodInstallArgs([]string{"--clean-install"}, "1.6.1")
+		require.Error(t, err)
+	}
+
+	t.Log("unknown flag")
+	{
+		warnings, err := validatePodInstallArgs([]string{"--plugin-flag=value"}, "1.10.1")
+		require.NoError(t, err)
+		require.Equal(t, []string{"unknown pod install flag: --plugin-flag"}, warnings)
+	}
+
+	t.Log("not a flag")
+	{
+		_, err := validatePodInstallArgs([]string{"update"}, "1.10.1")
+		require.Error(t, err)
+	}
+}
+
+func TestPodInstallCmdSlice(t *testing.T) {
+	require.Equal(t, []string{"pod", "install", "--no-repo-update", "--verbose"}, podInstallCmdSlice([]string{"pod"}, true, true, nil))
+	require.Equal(t, []string{"pod", "install", "--repo-update", "--clean-install"}, podInstallCmdSlice([]string{"pod"}, true, false, []string{"--repo-update", "--clean-install"}))
+	require.Equal(t, []string{"bundle", "exec", "pod", "install", "--verbose"}, podInstallCmdSlice([]string{"bundle", "exec", "pod"}, false, false, []string{"--verbose"}))
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bitrise-io/go-utils/command"
+	"github.com/bitrise-io/go-utils/log"
+	"github.com/bitrise-io/go-utils/pathutil"
+)
+
+// PodfileSearchOptions configures which directories are walked when searching for the Podfile.
+type PodfileSearchOptions struct {
+	ExcludePatterns []string
+	// MaxDepth is the maximum directory depth (relative to the search dir) to search in, 0 means no limit.
+	MaxDepth int
+	// IgnoredPaths are the search dir relative paths ignored by git.
+	IgnoredPaths map[string]bool
+}
+
+// PodfileSearchEntry is a Podfile candidate or a pruned directory of the Podfile search.
+type PodfileSearchEntry struct {
+	Path       string
+	SkipReason string
+}
+
+// builtinExcludedDirs are never searched for the Podfile.
+var builtinExcludedDirs = []string{"Carthage", "Pods", ".git", "*.framework"}
+
+// parseExcludePatterns parses a comma or newline separated glob list.
+func parseExcludePatterns(input string) []string {
+	var patterns []string
+	for _, field := range strings.FieldsFunc(input, func(r rune) bool {
+		return r == ',' || r == '\n'
+	}) {
+		if pattern := strings.TrimSpace(field); pattern != "" {
+			patterns = append(patterns, strings.TrimSuffix(pattern, "/"))
+		}
+	}
+	return patterns
+}
+
+// matchExcludePattern returns true if the pattern matches the relative path or any of its trailing subpaths,
+// so that both `node_modules` and `vendor/bundle` match at any depth.
+func matchExcludePattern(relPth, pattern string) bool {
+	components := strings.Split(filepath.ToSlash(relPth), "/")
+	for i := range components {
+		if match, err := filepath.Match(pattern, strings.Join(components[i:], "/")); err == nil && match {
+			return true
+		}
+	}
+	return false
+}
+
+// skipDirReason returns why the given (search dir relative) directory should not be walked, or an empty string if it should be.
+func skipDirReason(relPth string, opts PodfileSearchOptions) string {
+	for _, pattern := range builtinExcludedDirs {
+		if match, err := filepath.Match(pattern, filepath.Base(relPth)); err == nil && match {
+			return "excluded by default (" + pattern + ")"
+		}
+	}
+
+	for _, pattern := range opts.ExcludePatterns {
+		if matchExcludePattern(relPth, pattern) {
+			return "excluded by pattern (" + pattern + ")"
+		}
+	}
+
+	if opts.MaxDepth > 0 && len(strings.Split(filepath.ToSlash(relPth), "/")) > opts.MaxDepth {
+		return "deeper than the max search depth"
+	}
+
+	if opts.IgnoredPaths[filepath.ToSlash(relPth)] {
+		return "ignored by .gitignore"
+	}
+
+	return ""
+}
+
+// searchPodfiles walks the search dir, pruning the excluded directories, and returns the Podfile candidates and the pruned directories.
+func searchPodfiles(searchDir string, opts PodfileSearchOptions) ([]string, []PodfileSearchEntry, error) {
+	var podfiles []string
+	var skipped []PodfileSearchEntry
+
+	if err := filepath.Walk(searchDir, func(pth string, info os.FileInfo, walkErr error) error {
+		if walkErr != nil {
+			return walkErr
+		}
+
+		relPth, err := filepath.Rel(searchDir, pth)
+		if err != nil {
+			return err
+		}
+		if relPth == "." {
+			return nil
+		}
+
+		if info.IsDir() {
+			if reason := skipDirReason(relPth, opts); reason != "" {
+				skipped = append(skipped, PodfileSearchEntry{Path: pth, SkipReason: reason})
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if !strings.EqualFold(filepath.Base(pth), "Podfile") {
+			return nil
+		}
+
+		if opts.IgnoredPaths[filepath.ToSlash(relPth)] {
+			skipped = append(skipped, PodfileSearchEntry{Path: pth, SkipReason: "ignored by .gitignore"})
+			return nil
+		}
+
+		podfiles = append(podfiles, pth)
+		return nil
+	}); err != nil {
+		return nil, nil, err
+	}
+
+	return podfiles, skipped, nil
+}
+
+// findMostRootPodfile returns the Podfile closest to the search dir, and a report of every Podfile candidate and pruned directory.
+func findMostRootPodfile(searchDir string, opts PodfileSearchOptions) (string, []PodfileSearchEntry, error) {
+	podfiles, skipped, err := searchPodfiles(searchDir, opts)
+	if err != nil {
+		return "", nil, err
+	}
+
+	podfile, err := findMostRootPodfileInFileList(podfiles)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var report []PodfileSearchEntry
+	for _, pth := range podfiles {
+		entry := PodfileSearchEntry{Path: pth}
+		if pth != podfile {
+			entry.SkipReason = "a Podfile closer to the search dir was found"
+		}
+		report = append(report, entry)
+	}
+
+	return podfile, append(report, skipped...), nil
+}
+
+// searchPodfile searches the source root for the Podfile closest to it, and prints the search report.
+// The paths ignored by git are skipped if respectGitignore is set.
+func searchPodfile(sourceRootPath string, opts PodfileSearchOptions, respectGitignore bool) (string, error) {
+	fmt.Println()
+	log.Infof("Searching for Podfile")
+
+	absSourceRootPath, err := pathutil.AbsPath(sourceRootPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to expand (%s), error: %s", sourceRootPath, err)
+	}
+
+	if respectGitignore {
+		ignored, err := gitIgnoredPaths(absSourceRootPath)
+		if err != nil {
+			log.Warnf("Failed to list paths ignored by git, .gitignore won't be respected, error: %s", err)
+		}
+		opts.IgnoredPaths = ignored
+	}
+
+	podfilePth, report, err := findMostRootPodfile(absSourceRootPath, opts)
+	if err != nil {
+		return "", err
+	}
+
+	if len(report) > 0 {
+		log.Printf("Podfile search report:")
+		for _, entry := range report {
+			if entry.SkipReason == "" {
+				log.Printf("- %s: selected", entry.Path)
+			} else {
+				log.Printf("- %s: skipped, %s", entry.Path, entry.SkipReason)
+			}
+		}
+	}
+
+	if podfilePth == "" {
+		return "", fmt.Errorf("no Podfile found")
+	}
+
+	log.Donef("Found Podfile: %s", podfilePth)
+
+	return podfilePth, nil
+}
+
+// gitIgnoredPaths returns the paths (relative to the dir) ignored by git.
+func gitIgnoredPaths(dir string) (map[string]bool, error) {
+	out, err := command.New("git", "ls-files", "--others", "--ignored", "--exclude-standard", "--directory").SetDir(dir).RunAndReturnTrimmedOutput()
+	if err != nil {
+		return nil, err
+	}
+
+	ignored := map[string]bool{}
+	for _, line := range strings.Split(out, "\n") {
+		if line = strings.TrimSuffix(strings.TrimSpace(line), "/"); line != "" {
+			ignored[line] = true
+		}
+	}
+
+	log.Debugf("Paths ignored by git: %v", ignored)
+
+	return ignored, nil
+}
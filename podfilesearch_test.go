@@ -0,0 +1,107 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func createPodfiles(t *testing.T, dir string, relPths ...string) {
+	for _, relPth := range relPths {
+		pth := filepath.Join(dir, relPth)
+		require.NoError(t, os.MkdirAll(filepath.Dir(pth), 0755))
+		require.NoError(t, ioutil.WriteFile(pth, []byte("platform :ios, '11.0'\n"), 0644))
+	}
+}
+
+func TestMatchExcludePattern(t *testing.T) {
+	require.True(t, matchExcludePattern("node_modules", "node_modules"))
+	require.True(t, matchExcludePattern("packages/app/node_modules", "node_modules"))
+	require.True(t, matchExcludePattern("ios/vendor/bundle", "vendor/bundle"))
+	require.True(t, matchExcludePattern("ios/build-debug", "build*"))
+	require.False(t, matchExcludePattern("ios/vendor", "vendor/bundle"))
+	require.False(t, matchExcludePattern("ios/rebuild", "build"))
+}
+
+func TestFindMostRootPodfileWithSearchOptions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "podfile-search")
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, os.RemoveAll(dir))
+	}()
+
+	createPodfiles(t, dir,
+		"node_modules/some-package/example/Podfile",
+		"Pods/Podfile",
+		"ios/vendor/bundle/gems/example/Podfile",
+		"ios/Podfile",
+		"ios/example/app/Podfile",
+	)
+
+	t.Log("default exclusions")
+	{
+		opts := PodfileSearchOptions{ExcludePatterns: []string{"node_modules", "vendor/bundle"}}
+		podfile, report, err := findMostRootPodfile(dir, opts)
+		require.NoError(t, err)
+		require.Equal(t, filepath.Join(dir, "ios/Podfile"), podfile)
+		require.Equal(t, []PodfileSearchEntry{
+			{Path: filepath.Join(dir, "ios/Podfile")},
+			{Path: filepath.Join(dir, "ios/example/app/Podfile"), SkipReason: "a Podfile closer to the search dir was found"},
+			{Path: filepath.Join(dir, "Pods"), SkipReason: "excluded by default (Pods)"},
+			{Path: filepath.Join(dir, "ios/vendor/bundle"), SkipReason: "excluded by pattern (vendor/bundle)"},
+			{Path: filepath.Join(dir, "node_modules"), SkipReason: "excluded by pattern (node_modules)"},
+		}, report)
+	}
+
+	t.Log("max depth")
+	{
+		opts := PodfileSearchOptions{ExcludePatterns: []string{"ios"}, MaxDepth: 2}
+		podfile, _, err := findMostRootPodfile(dir, opts)
+		require.NoError(t, err)
+		require.Equal(t, "", podfile)
+	}
+
+	t.Log("ignored by git")
+	{
+		opts := PodfileSearchOptions{ExcludePatterns: []string{"node_modules", "vendor"}, IgnoredPaths: map[string]bool{"ios/Podfile": true}}
+		podfile, _, err := findMostRootPodfile(dir, opts)
+		require.NoError(t, err)
+		require.Equal(t, filepath.Join(dir, "ios/example/app/Podfile"), podfile)
+	}
+}
+
+func TestSearchPodfile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "podfile-search")
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, os.RemoveAll(dir))
+	}()
+
+	t.Log("fails without a Podfile")
+	{
+		_, err := searchPodfile(dir, PodfileSearchOptions{}, false)
+		require.EqualError(t, err, "no Podfile found")
+	}
+
+	createPodfiles(t, dir,
+		"node_modules/some-package/example/Podfile",
+		"ios/example/app/Podfile",
+	)
+
+	t.Log("returns the Podfile closest to the source root")
+	{
+		podfile, err := searchPodfile(dir, PodfileSearchOptions{ExcludePatterns: []string{"node_modules"}}, false)
+		require.NoError(t, err)
+		require.Equal(t, filepath.Join(dir, "ios/example/app/Podfile"), podfile)
+	}
+
+	t.Log("does not fail if the source root is not a git repository")
+	{
+		podfile, err := searchPodfile(dir, PodfileSearchOptions{ExcludePatterns: []string{"node_modules"}}, true)
+		require.NoError(t, err)
+		require.Equal(t, filepath.Join(dir, "ios/example/app/Podfile"), podfile)
+	}
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/bitrise-io/go-steputils/tools"
+	"github.com/bitrise-io/go-utils/fileutil"
+	"github.com/bitrise-io/go-utils/log"
+)
+
+// PodMessage kinds
+const (
+	PodMessageKindDeprecatedPod        = "deprecated_pod"
+	PodMessageKindBuildSettingOverride = "build_setting_override"
+	PodMessageKindIntegration          = "integration"
+	PodMessageKindOther                = "other"
+)
+
+// PodMessage severities
+const (
+	PodMessageSeverityWarning = "warning"
+	PodMessageSeverityError   = "error"
+)
+
+// PodMessage is a [!] warning or error block printed by CocoaPods.
+type PodMessage struct {
+	Kind     string `json:"kind"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+	Details  string `json:"details,omitempty"`
+	Pod      string `json:"pod,omitempty"`
+	Target   string `json:"target,omitempty"`
+	Setting  string `json:"setting,omitempty"`
+	Count    int    `json:"count"`
+}
+
+var (
+	ansiEscapeExp           = regexp.MustCompile(`\x1b\[[0-9;]*m`)
+	deprecatedPodExp        = regexp.MustCompile("^`?([^\\s`]+)`? has been deprecated")
+	buildSettingOverrideExp = regexp.MustCompile("The `(.+)` target overrides the `(.+)` build setting")
+	integrationExp          = regexp.MustCompile(`(?i)(integrat|Automatically assigning platform|Xcode sessions|client project|base configuration)`)
+	podErrorExp             = regexp.MustCompile(`(?i)(Unable to find|could not find compatible versions|Invalid .Podfile. file|No .Podfile. found|Failed to connect|Error installing|An error occurred|is not supported|requires a higher minimum)`)
+)
+
+// parsePodMessages parses the [!] blocks of the CocoaPods output, the indented lines following a [!] line are its details.
+// The messages are deduplicated, Count holds the number of occurrences.
+func parsePodMessages(output string) []PodMessage {
+	var messages []PodMessage
+	indexByMessage := map[string]int{}
+
+	var current *PodMessage
+	var details []string
+	flush := func() {
+		if current == nil {
+			return
+		}
+		current.Details = strings.TrimSpace(strings.Join(details, "\n"))
+
+		if idx, ok := indexByMessage[current.Message]; ok {
+			messages[idx].Count++
+		} else {
+			indexByMessage[current.Message] = len(messages)
+			messages = append(messages, *current)
+		}
+
+		current = nil
+		details = nil
+	}
+
+	for _, line := range strings.Split(ansiEscapeExp.ReplaceAllString(output, ""), "\n") {
+		line = strings.TrimRight(line, " \r")
+
+		if strings.HasPrefix(line, "[!] ") {
+			flush()
+			message := newPodMessage(strings.TrimSpace(strings.TrimPrefix(line, "[!] ")))
+			current = &message
+			continue
+		}
+
+		if current == nil {
+			continue
+		}
+
+		if line == "" || strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t") {
+			details = append(details, line)
+			continue
+		}
+
+		flush()
+	}
+	flush()
+
+	return messages
+}
+
+func newPodMessage(message string) PodMessage {
+	podMessage := PodMessage{Kind: PodMessageKindOther, Severity: PodMessageSeverityWarning, Message: message, Count: 1}
+
+	if match := deprecatedPodExp.FindStringSubmatch(message); match != nil {
+		podMessage.Kind = PodMessageKindDeprecatedPod
+		podMessage.Pod = match[1]
+	} else if match := buildSettingOverrideExp.FindStringSubmatch(message); match != nil {
+		podMessage.Kind = PodMessageKindBuildSettingOverride
+		podMessage.Target = match[1]
+		podMessage.Setting = match[2]
+	} else if integrationExp.MatchString(message) {
+		podMessage.Kind = PodMessageKindIntegration
+	}
+
+	if podErrorExp.MatchString(message) {
+		podMessage.Severity = PodMessageSeverityError
+	}
+
+	return podMessage
+}
+
+// PodOutputLog collects the output of the pod commands, and writes it to a log file if a path is given.
+type PodOutputLog struct {
+	mu   sync.Mutex
+	buf  bytes.Buffer
+	file *os.File
+}
+
+// NewPodOutputLog creates a PodOutputLog, writing into the file at pth if it is not empty.
+func NewPodOutputLog(pth string) (*PodOutputLog, error) {
+	podLog := &PodOutputLog{}
+	if pth == "" {
+		return podLog, nil
+	}
+
+	file, err := os.Create(pth)
+	if err != nil {
+		return nil, err
+	}
+	podLog.file = file
+
+	return podLog, nil
+}
+
+// Write ...
+func (l *PodOutputLog) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.buf.Write(p)
+	if l.file != nil {
+		if _, err := l.file.Write(p); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// Writer returns a writer which writes both to the given writer and the log.
+func (l *PodOutputLog) Writer(w io.Writer) io.Writer {
+	return io.MultiWriter(w, l)
+}
+
+// String returns the collected output.
+func (l *PodOutputLog) String() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.buf.String()
+}
+
+// Close closes the log file.
+func (l *PodOutputLog) Close() error {
+	if l.file == nil {
+		return nil
+	}
+	return l.file.Close()
+}
+
+// writePodMessagesJSON writes the messages as JSON to the deploy dir, and returns the file's path.
+func writePodMessagesJSON(messages []PodMessage, deployDir string) (string, error) {
+	if messages == nil {
+		messages = []PodMessage{}
+	}
+
+	content, err := json.MarshalIndent(messages, "", "  ")
+	if err != nil {
+		return "", err
+	}
+
+	pth := filepath.Join(deployDir, "pod_messages.json")
+	return pth, fileutil.WriteBytesToFile(pth, content)
+}
+
+// printAndExportPodMessages prints the deduplicated CocoaPods messages, and exports them (with the pod output log) to the deploy dir.
+func printAndExportPodMessages(messages []PodMessage, podLogPth, deployDir string) {
+	if len(messages) > 0 {
+		fmt.Println()
+		log.Infof("CocoaPods warnings and errors:")
+
+		for _, message := range messages {
+			summary := fmt.Sprintf("- [%s] %s", message.Kind, message.Message)
+			if message.Count > 1 {
+				summary += fmt.Sprintf(" (%dx)", message.Count)
+			}
+
+			if message.Severity == PodMessageSeverityError {
+				log.Errorf("%s", summary)
+			} else {
+				log.Warnf("%s", summary)
+			}
+		}
+	}
+
+	if deployDir == "" {
+		return
+	}
+
+	messagesPth, err := writePodMessagesJSON(messages, deployDir)
+	if err != nil {
+		log.Warnf("Failed to write CocoaPods messages, error: %s", err)
+		return
+	}
+
+	for key, value := range map[string]string{
+		"COCOAPODS_INSTALL_LOG_PATH": podLogPth,
+		"COCOAPODS_MESSAGES_PATH":    messagesPth,
+	} {
+		if err := tools.ExportEnvironmentWithEnvman(key, value); err != nil {
+			log.Warnf("Failed to export %s, error: %s", key, err)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePodMessages(t *testing.T) {
+	t.Log("warnings")
+	{
+		output := "Analyzing dependencies\n" +
+			"\x1b[33m[!] AFNetworking has been deprecated in favor of Alamofire\x1b[0m\n" +
+			"Downloading dependencies\n" +
+			"[!] The `MyApp [Debug]` target overrides the `OTHER_LDFLAGS` build setting defined in `Pods/Target Support Files/Pods-MyApp/Pods-MyApp.debug.xcconfig'. This can lead to problems with the CocoaPods installation\n" +
+			"    - Use the `$(inherited)` flag, or\n" +
+			"    - Remove the build settings from the target.\n" +
+			"\n" +
+			"[!] Automatically assigning platform `iOS` with version `9.0` on target `MyApp` because no platform was specified.\n" +
+			"Pod installation complete! There are 2 dependencies from the Podfile and 2 total pods installed.\n" +
+			"[!] AFNetworking has been deprecated in favor of Alamofire\n"
+
+		messages := parsePodMessages(output)
+		require.Equal(t, []PodMessage{
+			{
+				Kind:     PodMessageKindDeprecatedPod,
+				Severity: PodMessageSeverityWarning,
+				Message:  "AFNetworking has been deprecated in favor of Alamofire",
+				Pod:      "AFNetworking",
+				Count:    2,
+			},
+			{
+				Kind:     PodMessageKindBuildSettingOverride,
+				Severity: PodMessageSeverityWarning,
+				Message:  "The `MyApp [Debug]` target overrides the `OTHER_LDFLAGS` build setting defined in `Pods/Target Support Files/Pods-MyApp/Pods-MyApp.debug.xcconfig'. This can lead to problems with the CocoaPods installation",
+				Details:  "- Use the `$(inherited)` flag, or\n    - Remove the build settings from the target.",
+				Target:   "MyApp [Debug]",
+				Setting:  "OTHER_LDFLAGS",
+				Count:    1,
+			},
+			{
+				Kind:     PodMessageKindIntegration,
+				Severity: PodMessageSeverityWarning,
+				Message:  "Automatically assigning platform `iOS` with version `9.0` on target `MyApp` because no platform was specified.",
+				Count:    1,
+			},
+		}, messages)
+	}
+
+	t.Log("error")
+	{
+		output := `[!] CocoaPods could not find compatible versions for pod "Alamofire":
+  In Podfile:
+    Alamofire (~> 6.0)
+`
+
+		messages := parsePodMessages(output)
+		require.Equal(t, 1, len(messages))
+		require.Equal(t, PodMessageSeverityError, messages[0].Severity)
+		require.Equal(t, "In Podfile:\n    Alamofire (~> 6.0)", messages[0].Details)
+	}
+}
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/bitrise-io/go-steputils/tools"
+	"github.com/bitrise-io/go-utils/fileutil"
+	"github.com/bitrise-io/go-utils/log"
+	"github.com/bitrise-io/xcode-project/serialized"
+	"github.com/bitrise-io/xcode-project/xcodeproj"
+)
+
+const buildSettingsReportFileName = "cocoapods_build_settings.json"
+
+// BuildSettingRuleKind is how a rule changes a build setting.
+type BuildSettingRuleKind string
+
+// BuildSettingRuleKinds ...
+const (
+	// BuildSettingRuleSet sets the value on every build configuration.
+	BuildSettingRuleSet BuildSettingRuleKind = "="
+	// BuildSettingRuleFloor raises the versions lower than the value, it does not add the setting where it is not set.
+	BuildSettingRuleFloor BuildSettingRuleKind = ">="
+)
+
+// BuildSettingRule is a KEY=VALUE or KEY>=VERSION line of the pods_build_settings input.
+type BuildSettingRule struct {
+	Key   string
+	Kind  BuildSettingRuleKind
+	Value string
+}
+
+// BuildSettingChange is a build setting changed in a pods project.
+type BuildSettingChange struct {
+	Project       string `json:"project"`
+	Target        string `json:"target,omitempty"`
+	Configuration string `json:"configuration"`
+	Key           string `json:"key"`
+	From          string `json:"from"`
+	To            string `json:"to"`
+}
+
+var buildSettingKeyExp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// parseBuildSettingRules parses the rules, one per line, empty lines and # comments are skipped.
+func parseBuildSettingRules(input string) ([]BuildSettingRule, error) {
+	var rules []BuildSettingRule
+	keys := map[string]bool{}
+
+	for _, line := range strings.Split(input, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		idx := strings.Index(line, "=")
+		if idx == -1 {
+			return nil, fmt.Errorf("invalid build setting rule: %s, expected format: KEY=VALUE or KEY>=VERSION", line)
+		}
+
+		rule := BuildSettingRule{Key: strings.TrimSpace(line[:idx]), Kind: BuildSettingRuleSet, Value: strings.TrimSpace(line[idx+1:])}
+		if strings.HasSuffix(rule.Key, ">") {
+			rule.Key = strings.TrimSpace(strings.TrimSuffix(rule.Key, ">"))
+			rule.Kind = BuildSettingRuleFloor
+		}
+
+		if !buildSettingKeyExp.MatchString(rule.Key) {
+			return nil, fmt.Errorf("invalid build setting rule: %s, invalid build setting name: %s", line, rule.Key)
+		}
+		if rule.Kind == BuildSettingRuleFloor && !isValidVersion(rule.Value) {
+			return nil, fmt.Errorf("invalid build setting rule: %s, invalid version: %s", line, rule.Value)
+		}
+		if keys[rule.Key] {
+			return nil, fmt.Errorf("multiple build setting rules found for %s", rule.Key)
+		}
+		keys[rule.Key] = true
+
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
+
+// String returns the rule as it is written in the pods_build_settings input.
+func (r BuildSettingRule) String() string {
+	return fmt.Sprintf("%s%s%s", r.Key, r.Kind, r.Value)
+}
+
+// buildSettingString returns the value of a build setting as it is printed in the report, list values are space separated.
+func buildSettingString(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case []interface{}:
+		var items []string
+		for _, item := range v {
+			items = append(items, fmt.Sprint(item))
+		}
+		return strings.Join(items, " ")
+	}
+	return fmt.Sprint(value)
+}
+
+// buildSettingKeys returns the setting's key and its SDK specific variants (for example KEY[sdk=iphoneos*]) present in the build settings.
+func buildSettingKeys(buildSettings serialized.Object, key string) []string {
+	keys := []string{key}
+	prefix := key + "["
+	for existing := range buildSettings {
+		if strings.HasPrefix(existing, prefix) && strings.HasSuffix(existing, "]") {
+			keys = append(keys, existing)
+		}
+	}
+	sort.Strings(keys[1:])
+	return keys
+}
+
+// applyBuildSettingRule applies the rule to a build configuration's settings, and returns the changed keys with their previous values.
+// The SDK specific variants of the setting are changed too, as they would override the normalized value.
+// A floor rule skips the values which are not versions, for example a $(VARIABLE) reference.
+func applyBuildSettingRule(buildSettings serialized.Object, rule BuildSettingRule) map[string]string {
+	changed := map[string]string{}
+
+	for _, key := range buildSettingKeys(buildSettings, rule.Key) {
+		value, ok := buildSettings[key]
+
+		switch rule.Kind {
+		case BuildSettingRuleSet:
+			if current, isString := value.(string); ok && isString && current == rule.Value {
+				continue
+			}
+			if !ok && key != rule.Key {
+				continue
+			}
+		case BuildSettingRuleFloor:
+			current, isString := value.(string)
+			if !ok || !isString {
+				continue
+			}
+			if cmp, err := compareVersions(current, rule.Value); err != nil || cmp >= 0 {
+				continue
+			}
+		}
+
+		changed[key] = buildSettingString(value)
+		buildSettings[key] = rule.Value
+	}
+
+	return changed
+}
+
+// applyBuildSettingRules applies the rules to the build configurations of a target (or of the project if target is empty),
+// and returns the changes.
+func applyBuildSettingRules(project, target string, buildConfigurations []serialized.Object, rules []BuildSettingRule) ([]BuildSettingChange, error) {
+	var changes []BuildSettingChange
+
+	for _, buildConfiguration := range buildConfigurations {
+		name, err := buildConfiguration.String("name")
+		if err != nil {
+			return nil, err
+		}
+		buildSettings, err := buildConfiguration.Object("buildSettings")
+		if err != nil {
+			return nil, err
+		}
+
+		for _, rule := range rules {
+			changed := applyBuildSettingRule(buildSettings, rule)
+
+			keys := make([]string, 0, len(changed))
+			for key := range changed {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+
+			for _, key := range keys {
+				changes = append(changes, BuildSettingChange{
+					Project:       project,
+					Target:        target,
+					Configuration: name,
+					Key:           key,
+					From:          changed[key],
+					To:            rule.Value,
+				})
+			}
+		}
+	}
+
+	return changes, nil
+}
+
+// normalizePodsProject applies the rules to the project level and every target's build configurations of the project,
+// and saves the project if anything changed.
+func normalizePodsProject(projectPth string, rules []BuildSettingRule) ([]BuildSettingChange, error) {
+	project, err := xcodeproj.Open(projectPth)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s, error: %s", projectPth, err)
+	}
+
+	type configurationOwner struct {
+		id, target string
+	}
+	owners := []configurationOwner{{id: project.Proj.ID}}
+	for _, target := range project.Proj.Targets {
+		owners = append(owners, configurationOwner{id: target.ID, target: target.Name})
+	}
+
+	var changes []BuildSettingChange
+	for _, owner := range owners {
+		buildConfigurationList, err := project.BuildConfigurationList(owner.id)
+		if err != nil {
+			return nil, err
+		}
+		buildConfigurations, err := project.BuildConfigurations(buildConfigurationList)
+		if err != nil {
+			return nil, err
+		}
+
+		ownerChanges, err := applyBuildSettingRules(filepath.Base(projectPth), owner.target, buildConfigurations, rules)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the build configurations of %s, error: %s", projectPth, err)
+		}
+		changes = append(changes, ownerChanges...)
+	}
+
+	if len(changes) == 0 {
+		return nil, nil
+	}
+	if err := project.Save(); err != nil {
+		return nil, fmt.Errorf("failed to save %s, error: %s", projectPth, err)
+	}
+	return changes, nil
+}
+
+// normalizePodsProjects applies the rules to every project in the Pods dir:
+// Pods.xcodeproj, and the pod projects if generate_multiple_pod_projects is enabled.
+func normalizePodsProjects(podsDir string, rules []BuildSettingRule) ([]BuildSettingChange, error) {
+	projectPths, err := filepath.Glob(filepath.Join(podsDir, "*.xcodeproj"))
+	if err != nil {
+		return nil, err
+	}
+	if len(projectPths) == 0 {
+		return nil, fmt.Errorf("no Xcode project found in %s", podsDir)
+	}
+	sort.Strings(projectPths)
+
+	var changes []BuildSettingChange
+	for _, projectPth := range projectPths {
+		projectChanges, err := normalizePodsProject(projectPth, rules)
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, projectChanges...)
+	}
+	return changes, nil
+}
+
+// runPodsBuildSettingRules applies the rules to the projects of the Pods dir, prints the changes,
+// and writes them into the deploy dir if it is set.
+func runPodsBuildSettingRules(podsDir string, rules []BuildSettingRule, deployDir string) error {
+	if len(rules) == 0 {
+		return nil
+	}
+
+	fmt.Println()
+	log.Infof("Normalizing Pods project build settings")
+
+	changes, err := normalizePodsProjects(podsDir, rules)
+	if err != nil {
+		return err
+	}
+	printBuildSettingChanges(changes)
+
+	if deployDir != "" {
+		if err := exportBuildSettingChanges(changes, deployDir); err != nil {
+			log.Warnf("Failed to export build setting changes, error: %s", err)
+		}
+	}
+	return nil
+}
+
+// printBuildSettingChanges prints the changes, one line per changed setting.
+func printBuildSettingChanges(changes []BuildSettingChange) {
+	if len(changes) == 0 {
+		log.Printf("No build setting changed")
+		return
+	}
+
+	for _, change := range changes {
+		owner := change.Project
+		if change.Target != "" {
+			owner = fmt.Sprintf("%s/%s", change.Project, change.Target)
+		}
+		log.Printf("%s (%s): %s: %q -> %q", owner, change.Configuration, change.Key, change.From, change.To)
+	}
+	log.Donef("Changed %d build setting(s)", len(changes))
+}
+
+// exportBuildSettingChanges writes the changes as JSON into the deploy dir and exports its path.
+func exportBuildSettingChanges(changes []BuildSettingChange, deployDir string) error {
+	if changes == nil {
+		changes = []BuildSettingChange{}
+	}
+	content, err := json.MarshalIndent(changes, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	pth := filepath.Join(deployDir, buildSettingsReportFileName)
+	if err := fileutil.WriteBytesToFile(pth, content); err != nil {
+		return err
+	}
+	return tools.ExportEnvironmentWithEnvman("COCOAPODS_BUILD_SETTINGS_REPORT_PATH", pth)
+}
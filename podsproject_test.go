@@ -0,0 +1,249 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bitrise-io/xcode-project/serialized"
+	"github.com/bitrise-io/xcode-project/xcodeproj"
+	"github.com/stretchr/testify/require"
+)
+
+const testPodsPbxproj = `// !$*UTF8*$!
+{
+	archiveVersion = 1;
+	classes = {
+	};
+	objectVersion = 51;
+	objects = {
+
+/* Begin PBXAggregateTarget section */
+		AAAA00000000000000000001 /* Alamofire */ = {
+			isa = PBXAggregateTarget;
+			buildConfigurationList = AAAA00000000000000000002 /* Build configuration list for PBXAggregateTarget "Alamofire" */;
+			buildPhases = (
+			);
+			dependencies = (
+			);
+			name = Alamofire;
+		};
+/* End PBXAggregateTarget section */
+
+/* Begin PBXProject section */
+		AAAA00000000000000000003 /* Project object */ = {
+			isa = PBXProject;
+			attributes = {
+				LastUpgradeCheck = 1240;
+			};
+			buildConfigurationList = AAAA00000000000000000004 /* Build configuration list for PBXProject "Pods" */;
+			targets = (
+				AAAA00000000000000000001 /* Alamofire */,
+			);
+		};
+/* End PBXProject section */
+
+/* Begin XCBuildConfiguration section */
+		AAAA00000000000000000005 /* Debug */ = {
+			isa = XCBuildConfiguration;
+			buildSettings = {
+				IPHONEOS_DEPLOYMENT_TARGET = 10.0;
+				"IPHONEOS_DEPLOYMENT_TARGET[sdk=iphonesimulator*]" = 9.0;
+				ENABLE_BITCODE = YES;
+			};
+			name = Debug;
+		};
+		AAAA00000000000000000006 /* Project Debug */ = {
+			isa = XCBuildConfiguration;
+			buildSettings = {
+				IPHONEOS_DEPLOYMENT_TARGET = 13.0;
+			};
+			name = Debug;
+		};
+/* End XCBuildConfiguration section */
+
+/* Begin XCConfigurationList section */
+		AAAA00000000000000000002 /* Build configuration list for PBXAggregateTarget "Alamofire" */ = {
+			isa = XCConfigurationList;
+			buildConfigurations = (
+				AAAA00000000000000000005 /* Debug */,
+			);
+			defaultConfigurationName = Debug;
+		};
+		AAAA00000000000000000004 /* Build configuration list for PBXProject "Pods" */ = {
+			isa = XCConfigurationList;
+			buildConfigurations = (
+				AAAA00000000000000000006 /* Project Debug */,
+			);
+			defaultConfigurationName = Debug;
+		};
+/* End XCConfigurationList section */
+	};
+	rootObject = AAAA00000000000000000003 /* Project object */;
+}
+`
+
+func TestParseBuildSettingRules(t *testing.T) {
+	t.Log("valid rules")
+	{
+		rules, err := parseBuildSettingRules(`
+# raise the deployment target
+IPHONEOS_DEPLOYMENT_TARGET >= 12.0
+BUILD_LIBRARY_FOR_DISTRIBUTION=YES
+OTHER_SWIFT_FLAGS = $(inherited) -DPODS
+CODE_SIGNING_ALLOWED=
+`)
+		require.NoError(t, err)
+		require.Equal(t, []BuildSettingRule{
+			{Key: "IPHONEOS_DEPLOYMENT_TARGET", Kind: BuildSettingRuleFloor, Value: "12.0"},
+			{Key: "BUILD_LIBRARY_FOR_DISTRIBUTION", Kind: BuildSettingRuleSet, Value: "YES"},
+			{Key: "OTHER_SWIFT_FLAGS", Kind: BuildSettingRuleSet, Value: "$(inherited) -DPODS"},
+			{Key: "CODE_SIGNING_ALLOWED", Kind: BuildSettingRuleSet, Value: ""},
+		}, rules)
+	}
+
+	t.Log("empty input")
+	{
+		rules, err := parseBuildSettingRules("")
+		require.NoError(t, err)
+		require.Nil(t, rules)
+	}
+
+	t.Log("invalid rules")
+	{
+		for _, input := range []string{
+			"ENABLE_BITCODE",
+			"ENABLE BITCODE=NO",
+			"=NO",
+			"IPHONEOS_DEPLOYMENT_TARGET>=",
+			"IPHONEOS_DEPLOYMENT_TARGET>=latest",
+			"ENABLE_BITCODE=NO\nENABLE_BITCODE=YES",
+		} {
+			_, err := parseBuildSettingRules(input)
+			require.Error(t, err, input)
+		}
+	}
+}
+
+func TestApplyBuildSettingRule(t *testing.T) {
+	t.Log("floor raises the lower versions and the SDK specific variants")
+	{
+		buildSettings := serialized.Object{
+			"IPHONEOS_DEPLOYMENT_TARGET":                       "9.0",
+			"IPHONEOS_DEPLOYMENT_TARGET[sdk=iphonesimulator*]": "13.0",
+		}
+		changed := applyBuildSettingRule(buildSettings, BuildSettingRule{Key: "IPHONEOS_DEPLOYMENT_TARGET", Kind: BuildSettingRuleFloor, Value: "12.0"})
+		require.Equal(t, map[string]string{"IPHONEOS_DEPLOYMENT_TARGET": "9.0"}, changed)
+		require.Equal(t, "12.0", buildSettings["IPHONEOS_DEPLOYMENT_TARGET"])
+		require.Equal(t, "13.0", buildSettings["IPHONEOS_DEPLOYMENT_TARGET[sdk=iphonesimulator*]"])
+	}
+
+	t.Log("floor does not add the setting and skips non-version values")
+	{
+		buildSettings := serialized.Object{"MACOSX_DEPLOYMENT_TARGET": "$(RECOMMENDED_MACOSX_DEPLOYMENT_TARGET)"}
+		require.Empty(t, applyBuildSettingRule(buildSettings, BuildSettingRule{Key: "MACOSX_DEPLOYMENT_TARGET", Kind: BuildSettingRuleFloor, Value: "10.13"}))
+		require.Empty(t, applyBuildSettingRule(buildSettings, BuildSettingRule{Key: "IPHONEOS_DEPLOYMENT_TARGET", Kind: BuildSettingRuleFloor, Value: "12.0"}))
+		require.Equal(t, serialized.Object{"MACOSX_DEPLOYMENT_TARGET": "$(RECOMMENDED_MACOSX_DEPLOYMENT_TARGET)"}, buildSettings)
+	}
+
+	t.Log("set adds, overrides and skips the unchanged values")
+	{
+		buildSettings := serialized.Object{
+			"ENABLE_BITCODE":                 "YES",
+			"ENABLE_BITCODE[sdk=iphoneos*]":  "YES",
+			"OTHER_LDFLAGS":                  []interface{}{"$(inherited)", "-ObjC"},
+			"BUILD_LIBRARY_FOR_DISTRIBUTION": "YES",
+		}
+		require.Equal(t, map[string]string{"ENABLE_BITCODE": "YES", "ENABLE_BITCODE[sdk=iphoneos*]": "YES"},
+			applyBuildSettingRule(buildSettings, BuildSettingRule{Key: "ENABLE_BITCODE", Kind: BuildSettingRuleSet, Value: "NO"}))
+		require.Equal(t, map[string]string{"OTHER_LDFLAGS": "$(inherited) -ObjC"},
+			applyBuildSettingRule(buildSettings, BuildSettingRule{Key: "OTHER_LDFLAGS", Kind: BuildSettingRuleSet, Value: "$(inherited)"}))
+		require.Equal(t, map[string]string{"SWIFT_VERSION": ""},
+			applyBuildSettingRule(buildSettings, BuildSettingRule{Key: "SWIFT_VERSION", Kind: BuildSettingRuleSet, Value: "5.0"}))
+		require.Empty(t, applyBuildSettingRule(buildSettings, BuildSettingRule{Key: "BUILD_LIBRARY_FOR_DISTRIBUTION", Kind: BuildSettingRuleSet, Value: "YES"}))
+		require.Equal(t, serialized.Object{
+			"ENABLE_BITCODE":                 "NO",
+			"ENABLE_BITCODE[sdk=iphoneos*]":  "NO",
+			"OTHER_LDFLAGS":                  "$(inherited)",
+			"BUILD_LIBRARY_FOR_DISTRIBUTION": "YES",
+			"SWIFT_VERSION":                  "5.0",
+		}, buildSettings)
+	}
+}
+
+func TestNormalizePodsProjects(t *testing.T) {
+	podsDir, err := ioutil.TempDir("", "Pods")
+	require.NoError(t, err)
+	defer func() { require.NoError(t, os.RemoveAll(podsDir)) }()
+
+	t.Log("fails without a project")
+	{
+		_, err := normalizePodsProjects(podsDir, nil)
+		require.Error(t, err)
+	}
+
+	projectPth := filepath.Join(podsDir, "Pods.xcodeproj")
+	require.NoError(t, os.MkdirAll(projectPth, 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(projectPth, "project.pbxproj"), []byte(testPodsPbxproj), 0644))
+
+	rules, err := parseBuildSettingRules("IPHONEOS_DEPLOYMENT_TARGET>=12.0\nENABLE_BITCODE=NO")
+	require.NoError(t, err)
+
+	t.Log("changes the project and target build settings")
+	{
+		changes, err := normalizePodsProjects(podsDir, rules)
+		require.NoError(t, err)
+		require.Equal(t, []BuildSettingChange{
+			{Project: "Pods.xcodeproj", Configuration: "Debug", Key: "ENABLE_BITCODE", From: "", To: "NO"},
+			{Project: "Pods.xcodeproj", Target: "Alamofire", Configuration: "Debug", Key: "IPHONEOS_DEPLOYMENT_TARGET", From: "10.0", To: "12.0"},
+			{Project: "Pods.xcodeproj", Target: "Alamofire", Configuration: "Debug", Key: "IPHONEOS_DEPLOYMENT_TARGET[sdk=iphonesimulator*]", From: "9.0", To: "12.0"},
+			{Project: "Pods.xcodeproj", Target: "Alamofire", Configuration: "Debug", Key: "ENABLE_BITCODE", From: "YES", To: "NO"},
+		}, changes)
+
+		project, err := xcodeproj.Open(projectPth)
+		require.NoError(t, err)
+		buildSettings := project.Proj.Targets[0].BuildConfigurationList.BuildConfigurations[0].BuildSettings
+		require.Equal(t, "12.0", buildSettings["IPHONEOS_DEPLOYMENT_TARGET"])
+		require.Equal(t, "12.0", buildSettings["IPHONEOS_DEPLOYMENT_TARGET[sdk=iphonesimulator*]"])
+		require.Equal(t, "NO", buildSettings["ENABLE_BITCODE"])
+		require.Equal(t, "13.0", project.Proj.BuildConfigurationList.BuildConfigurations[0].BuildSettings["IPHONEOS_DEPLOYMENT_TARGET"])
+	}
+
+	t.Log("does not change a normalized project")
+	{
+		changes, err := normalizePodsProjects(podsDir, rules)
+		require.NoError(t, err)
+		require.Nil(t, changes)
+	}
+}
+
+func TestRunPodsBuildSettingRules(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "build_settings")
+	require.NoError(t, err)
+	defer func() { require.NoError(t, os.RemoveAll(tmpDir)) }()
+
+	podsDir := filepath.Join(tmpDir, "Pods")
+	deployDir := filepath.Join(tmpDir, "deploy")
+	projectPth := filepath.Join(podsDir, "Pods.xcodeproj")
+	require.NoError(t, os.MkdirAll(projectPth, 0755))
+	require.NoError(t, os.MkdirAll(deployDir, 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(projectPth, "project.pbxproj"), []byte(testPodsPbxproj), 0644))
+
+	t.Log("does nothing without rules")
+	{
+		require.NoError(t, runPodsBuildSettingRules(filepath.Join(tmpDir, "missing"), nil, deployDir))
+		require.False(t, isPathExists(filepath.Join(deployDir, buildSettingsReportFileName)))
+	}
+
+	t.Log("writes the changes into the deploy dir")
+	{
+		rules, err := parseBuildSettingRules("ENABLE_BITCODE=NO")
+		require.NoError(t, err)
+		require.NoError(t, runPodsBuildSettingRules(podsDir, rules, deployDir))
+
+		content, err := ioutil.ReadFile(filepath.Join(deployDir, buildSettingsReportFileName))
+		require.NoError(t, err)
+		require.Contains(t, string(content), `"key": "ENABLE_BITCODE"`)
+	}
+}
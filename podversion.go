@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/bitrise-io/go-steputils/command/rubycommand"
+	"github.com/bitrise-io/go-utils/command"
+	"github.com/bitrise-io/go-utils/log"
+)
+
+// PodVersionMismatchPolicy is what to do if the running CocoaPods version does not satisfy the required one.
+type PodVersionMismatchPolicy string
+
+// PodVersionMismatchPolicies ...
+const (
+	PodVersionMismatchPolicyFail PodVersionMismatchPolicy = "fail"
+	PodVersionMismatchPolicyWarn PodVersionMismatchPolicy = "warn"
+)
+
+// PodOrigin is where the invoked pod executable comes from.
+type PodOrigin string
+
+// PodOrigins ...
+const (
+	PodOriginBundler     PodOrigin = "bundler"
+	PodOriginIsolatedDir PodOrigin = "isolated gem dir"
+	PodOriginRbenvShim   PodOrigin = "rbenv shim"
+	PodOriginPath        PodOrigin = "PATH"
+)
+
+// isGemRequirementSatisfied checks the version against a RubyGems requirement list, for example: ">= 1.10.0, < 2.0".
+// The supported operators are: =, !=, >, <, >=, <= and ~> (pessimistic), a requirement without operator means =.
+func isGemRequirementSatisfied(version, requirements string) (bool, error) {
+	for _, requirement := range strings.Split(requirements, ",") {
+		fields := strings.Fields(requirement)
+
+		operator, requiredVersion := "=", ""
+		switch len(fields) {
+		case 1:
+			requiredVersion = fields[0]
+		case 2:
+			operator, requiredVersion = fields[0], fields[1]
+		default:
+			return false, fmt.Errorf("invalid requirement: %s", requirement)
+		}
+
+		cmp, err := compareVersions(version, requiredVersion)
+		if err != nil {
+			return false, err
+		}
+
+		satisfied := false
+		switch operator {
+		case "=":
+			satisfied = cmp == 0
+		case "!=":
+			satisfied = cmp != 0
+		case ">":
+			satisfied = cmp > 0
+		case "<":
+			satisfied = cmp < 0
+		case ">=":
+			satisfied = cmp >= 0
+		case "<=":
+			satisfied = cmp <= 0
+		case "~>":
+			upper, err := pessimisticUpperBound(requiredVersion)
+			if err != nil {
+				return false, err
+			}
+			upperCmp, err := compareVersions(version, upper)
+			if err != nil {
+				return false, err
+			}
+			satisfied = cmp >= 0 && upperCmp < 0
+		default:
+			return false, fmt.Errorf("unknown requirement operator: %s", operator)
+		}
+
+		if !satisfied {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// pessimisticUpperBound returns the exclusive upper bound of a ~> requirement: ~> 1.10.1 means < 1.11, ~> 1.10 means < 2.
+// The prerelease segments are ignored: ~> 1.12.0.beta.1 means < 1.13.
+func pessimisticUpperBound(version string) (string, error) {
+	segments := strings.Split(releaseVersion(version), ".")
+	if len(segments) > 1 {
+		segments = segments[:len(segments)-1]
+	}
+
+	last, err := versionSegment(segments, len(segments)-1)
+	if err != nil {
+		return "", fmt.Errorf("invalid version: %s, error: %s", version, err)
+	}
+	segments[len(segments)-1] = fmt.Sprintf("%d", last+1)
+
+	return strings.Join(segments, "."), nil
+}
+
+// isRbenvShimNotFound checks if the output is the rbenv shim's error, printed when the selected ruby has no pod executable.
+func isRbenvShimNotFound(output string) bool {
+	return strings.Contains(output, "rbenv: pod: command not found")
+}
+
+// podOrigin returns where the pod executable of the command comes from, and its path if it is looked up in the PATH.
+func podOrigin(podCmdSlice []string, isolatedGemDir string) (PodOrigin, string) {
+	if len(podCmdSlice) > 0 && podCmdSlice[0] == "bundle" {
+		return PodOriginBundler, ""
+	}
+	if isolatedGemDir != "" {
+		return PodOriginIsolatedDir, isolatedGemDir
+	}
+	if len(podCmdSlice) > 0 && podCmdSlice[0] != "pod" {
+		return PodOriginPath, podCmdSlice[0]
+	}
+
+	pth, err := command.New("which", "pod").RunAndReturnTrimmedCombinedOutput()
+	if err != nil {
+		return PodOriginPath, ""
+	}
+	if strings.Contains(pth, "/shims/") {
+		return PodOriginRbenvShim, pth
+	}
+	return PodOriginPath, pth
+}
+
+// podVersionMismatchMessage explains the mismatch of the running and the required CocoaPods version.
+func podVersionMismatchMessage(podVersion string, origin PodOrigin, podPth, requirement, requirementSource string) string {
+	from := string(origin)
+	if podPth != "" {
+		from = fmt.Sprintf("%s: %s", origin, podPth)
+	}
+
+	message := fmt.Sprintf("The running CocoaPods version (%s, from %s) does not satisfy the version required by %s (%s).", podVersion, from, requirementSource, requirement)
+	switch origin {
+	case PodOriginBundler:
+		message += " Make sure the Gemfile.lock is up to date and committed."
+	case PodOriginRbenvShim:
+		message += " The rbenv shim runs the pod of the selected ruby, check the .ruby-version file and the gems installed for that ruby."
+	case PodOriginPath:
+		message += " Another pod executable precedes the required one in the PATH."
+	}
+	return message + " Running pod install with a different version rewrites the Podfile.lock."
+}
+
+// checkPodVersion runs pod --version, and checks the running CocoaPods version against the requirement, if both are known.
+// It returns the running version, which is empty if it can not be parsed from the output.
+func checkPodVersion(podCmdSlice []string, isolatedGemDir, dir string, envs []string, requirement, requirementSource string, policy PodVersionMismatchPolicy, podLog *PodOutputLog) (string, error) {
+	fmt.Println()
+	log.Infof("cocoapods version:")
+
+	// pod can be in the PATH as an rbenv shim and pod --version will return "rbenv: pod: command not found"
+	cmd, err := rubycommand.NewFromSlice(append(podCmdSlice, "--version"))
+	if err != nil {
+		return "", fmt.Errorf("failed to create command model, error: %s", err)
+	}
+
+	var output, errOutput bytes.Buffer
+	cmd.SetStdout(podLog.Writer(io.MultiWriter(os.Stdout, &output))).SetStderr(podLog.Writer(io.MultiWriter(os.Stderr, &errOutput)))
+	cmd.SetDir(dir)
+	cmd.AppendEnvs(envs...)
+
+	origin, podPth := podOrigin(podCmdSlice, isolatedGemDir)
+
+	log.Donef("$ %s", redactSecrets(cmd.PrintableCommandArgs()))
+	if err := runCommand(cmd); err != nil {
+		if isRbenvShimNotFound(output.String() + errOutput.String()) {
+			return "", fmt.Errorf("pod is an rbenv shim (%s), but the selected ruby has no CocoaPods installed, check the .ruby-version file, error: %s", podPth, err)
+		}
+		return "", fmt.Errorf("command failed, error: %s", err)
+	}
+
+	podVersion := cocoapodsVersionFromVersionOutput(output.String())
+	if podVersion == "" {
+		log.Warnf("Failed to parse the CocoaPods version from the pod --version output")
+		return "", nil
+	}
+	log.Printf("Running CocoaPods %s from %s %s", podVersion, origin, podPth)
+
+	return podVersion, checkPodVersionRequirement(podVersion, origin, podPth, requirement, requirementSource, policy)
+}
+
+// checkPodVersionRequirement checks the running CocoaPods version against the requirement, if it is set.
+// A mismatch is an error, unless the policy is warn.
+func checkPodVersionRequirement(podVersion string, origin PodOrigin, podPth, requirement, requirementSource string, policy PodVersionMismatchPolicy) error {
+	if requirement == "" {
+		return nil
+	}
+
+	satisfied, err := isGemRequirementSatisfied(podVersion, requirement)
+	if err != nil {
+		return fmt.Errorf("failed to compare CocoaPods version (%s) with the requirement (%s), error: %s", podVersion, requirement, err)
+	}
+
+	if !satisfied {
+		message := podVersionMismatchMessage(podVersion, origin, podPth, requirement, requirementSource)
+		if policy != PodVersionMismatchPolicyWarn {
+			return fmt.Errorf("%s", message)
+		}
+		log.Warnf("%s", message)
+		return nil
+	}
+
+	log.Donef("CocoaPods %s satisfies the version required by %s (%s)", podVersion, requirementSource, requirement)
+	return nil
+}
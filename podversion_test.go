@@ -0,0 +1,125 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsGemRequirementSatisfied(t *testing.T) {
+	for _, tc := range []struct {
+		version     string
+		requirement string
+		satisfied   bool
+	}{
+		{"1.10.1", "1.10.1", true},
+		{"1.10.1", "= 1.10.1", true},
+		{"1.10", "= 1.10.0", true},
+		{"1.11.0", "1.1.0", false},
+		{"1.10.2", "!= 1.10.1", true},
+		{"1.10.2", "> 1.10.1", true},
+		{"1.10.1", "> 1.10.1", false},
+		{"1.9.3", "< 1.10", true},
+		{"1.10.0", ">= 1.10", true},
+		{"1.10.0", "<= 1.9.3", false},
+		{"1.10.5", "~> 1.10.1", true},
+		{"1.11.0", "~> 1.10.1", false},
+		{"1.10.0", "~> 1.10.1", false},
+		{"1.11.0", "~> 1.10", true},
+		{"2.0.0", "~> 1.10", false},
+		{"1.10.1", ">= 1.10.0, < 2.0", true},
+		{"2.0.0", ">= 1.10.0, < 2.0", false},
+		{"1.12.0.beta.1", "1.12.0.beta.1", true},
+		{"1.12.0", "1.12.0.beta.1", false},
+		{"1.12.0.beta.1", "< 1.12", true},
+		{"1.12.0.rc.1", "~> 1.12.0.beta.1", true},
+		{"1.12.0", "~> 1.12.0.beta.1", true},
+		{"1.12.0.beta.1", "~> 1.12.0.beta", true},
+		{"1.12.0.rc.1", "~> 1.12.0.beta", true},
+		{"1.12.1", "~> 1.12.0.beta", true},
+		{"1.11.3", "~> 1.12.0.beta", false},
+		{"1.13.0", "~> 1.12.0.beta", false},
+		{"1.12.0.rc.1", ">= 1.11", true},
+		{"1.11.0.rc.1", ">= 1.11", false},
+		{"1.12.0.rc.1", ">= 1.11, < 1.12", true},
+	} {
+		satisfied, err := isGemRequirementSatisfied(tc.version, tc.requirement)
+		require.NoError(t, err)
+		require.Equal(t, tc.satisfied, satisfied, "%s %s", tc.version, tc.requirement)
+	}
+
+	t.Log("invalid requirement")
+	{
+		_, err := isGemRequirementSatisfied("1.10.1", "=~ 1.10.1")
+		require.Error(t, err)
+
+		_, err = isGemRequirementSatisfied("1.10.1", ">= 1 2")
+		require.Error(t, err)
+	}
+}
+
+func TestPessimisticUpperBound(t *testing.T) {
+	for version, upper := range map[string]string{
+		"1.10.1": "1.11",
+		"1.10":   "2",
+		"1":      "2",
+
+		"1.12.0.beta.1": "1.13",
+	} {
+		actual, err := pessimisticUpperBound(version)
+		require.NoError(t, err)
+		require.Equal(t, upper, actual)
+	}
+}
+
+func TestIsRbenvShimNotFound(t *testing.T) {
+	output := `rbenv: pod: command not found
+
+The 'pod' command exists in these Ruby versions:
+  2.6.5`
+	require.True(t, isRbenvShimNotFound(output))
+	require.False(t, isRbenvShimNotFound("1.10.1"))
+}
+
+func TestPodOrigin(t *testing.T) {
+	origin, pth := podOrigin([]string{"bundle", "_2.1.4_", "exec", "pod"}, "")
+	require.Equal(t, PodOriginBundler, origin)
+	require.Equal(t, "", pth)
+
+	origin, pth = podOrigin([]string{"/gems/2.7.4/cocoapods-1.10.1/bin/pod"}, "/gems/2.7.4/cocoapods-1.10.1")
+	require.Equal(t, PodOriginIsolatedDir, origin)
+	require.Equal(t, "/gems/2.7.4/cocoapods-1.10.1", pth)
+
+	origin, pth = podOrigin([]string{"/Users/vagrant/.gem/ruby/2.7.0/bin/pod", "_1.10.1_"}, "")
+	require.Equal(t, PodOriginPath, origin)
+	require.Equal(t, "/Users/vagrant/.gem/ruby/2.7.0/bin/pod", pth)
+}
+
+func TestPodVersionMismatchMessage(t *testing.T) {
+	message := podVersionMismatchMessage("1.11.0", PodOriginRbenvShim, "/Users/vagrant/.rbenv/shims/pod", "1.10.1", "Podfile.lock")
+	require.Contains(t, message, "The running CocoaPods version (1.11.0, from rbenv shim: /Users/vagrant/.rbenv/shims/pod) does not satisfy the version required by Podfile.lock (1.10.1).")
+	require.Contains(t, message, ".ruby-version")
+}
+
+func TestCheckPodVersionRequirement(t *testing.T) {
+	t.Log("no requirement")
+	{
+		require.NoError(t, checkPodVersionRequirement("1.10.1", PodOriginPath, "/usr/local/bin/pod", "", "", PodVersionMismatchPolicyFail))
+	}
+
+	t.Log("satisfied requirement")
+	{
+		require.NoError(t, checkPodVersionRequirement("1.10.1", PodOriginPath, "/usr/local/bin/pod", "~> 1.10.0", "Gemfile.lock", PodVersionMismatchPolicyFail))
+	}
+
+	t.Log("mismatch fails with the fail policy and warns with the warn policy")
+	{
+		require.Error(t, checkPodVersionRequirement("1.10.1", PodOriginPath, "/usr/local/bin/pod", "1.11.2", "Podfile.lock", PodVersionMismatchPolicyFail))
+		require.NoError(t, checkPodVersionRequirement("1.10.1", PodOriginPath, "/usr/local/bin/pod", "1.11.2", "Podfile.lock", PodVersionMismatchPolicyWarn))
+	}
+
+	t.Log("invalid requirement")
+	{
+		require.Error(t, checkPodVersionRequirement("1.10.1", PodOriginPath, "/usr/local/bin/pod", "~>", "Podfile.lock", PodVersionMismatchPolicyWarn))
+	}
+}
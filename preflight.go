@@ -0,0 +1,306 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"syscall"
+
+	"github.com/bitrise-io/go-utils/fileutil"
+	"github.com/bitrise-io/go-utils/log"
+)
+
+// PreflightStatus is the result of a pre-flight check.
+type PreflightStatus string
+
+// PreflightStatuses ...
+const (
+	PreflightStatusPass PreflightStatus = "pass"
+	PreflightStatusWarn PreflightStatus = "warn"
+	PreflightStatusFail PreflightStatus = "fail"
+)
+
+// PreflightResult is the result of a pre-flight check, with a hint on how to fix it if it did not pass.
+type PreflightResult struct {
+	Check   string
+	Status  PreflightStatus
+	Message string
+	Hint    string
+}
+
+// PreflightInput is what the pre-flight checks inspect.
+type PreflightInput struct {
+	PodfileDir      string
+	PodfilePth      string
+	PodfileLockPth  string
+	GemfileLockPth  string
+	RequiredVersion string
+	Env             func(string) string
+	FreeDiskSpace   func(string) (uint64, error)
+}
+
+const (
+	preflightDiskSpaceWarnLimit = 5 << 30
+	preflightDiskSpaceFailLimit = 1 << 30
+)
+
+func preflightPassed(check, message string) PreflightResult {
+	return PreflightResult{Check: check, Status: PreflightStatusPass, Message: message}
+}
+
+// mergeConflictMarkerLines returns the 1-based numbers of the lines starting with a git merge conflict marker.
+func mergeConflictMarkerLines(content string) []int {
+	var lines []int
+	for i, line := range strings.Split(content, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if strings.HasPrefix(line, "<<<<<<< ") || strings.HasPrefix(line, ">>>>>>> ") || line == "=======" || line == "<<<<<<<" || line == ">>>>>>>" {
+			lines = append(lines, i+1)
+		}
+	}
+	return lines
+}
+
+func checkMergeConflictMarkers(pths ...string) PreflightResult {
+	const check = "Merge conflict markers"
+
+	var conflicted []string
+	for _, pth := range pths {
+		if pth == "" || !isPathExists(pth) {
+			continue
+		}
+		content, err := fileutil.ReadStringFromFile(pth)
+		if err != nil {
+			return PreflightResult{Check: check, Status: PreflightStatusWarn, Message: fmt.Sprintf("failed to read %s: %s", pth, err)}
+		}
+		if lines := mergeConflictMarkerLines(content); len(lines) > 0 {
+			conflicted = append(conflicted, fmt.Sprintf("%s (line %d)", pth, lines[0]))
+		}
+	}
+
+	if len(conflicted) > 0 {
+		return PreflightResult{
+			Check:   check,
+			Status:  PreflightStatusFail,
+			Message: "unresolved merge conflict in " + strings.Join(conflicted, ", "),
+			Hint:    "Resolve the conflict and commit the file, for a lockfile run pod install or bundle install locally to regenerate it.",
+		}
+	}
+	return preflightPassed(check, "no merge conflict markers found")
+}
+
+// :path: "../node_modules/react-native/" (in the EXTERNAL SOURCES section)
+var podfileLockPathSourceExp = regexp.MustCompile(`^\s+:path:\s*"?([^"]+)"?\s*$`)
+
+// parsePodfileLockPathSources returns the :path external sources of the Podfile.lock, by pod name.
+func parsePodfileLockPathSources(content string) map[string]string {
+	sources := map[string]string{}
+	inSection := false
+	pod := ""
+
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimRight(line, "\r")
+
+		if line == "EXTERNAL SOURCES:" {
+			inSection = true
+			continue
+		}
+		if !inSection {
+			continue
+		}
+		if !strings.HasPrefix(line, "  ") {
+			break
+		}
+
+		if !strings.HasPrefix(line, "    ") {
+			pod = strings.Trim(strings.TrimSuffix(strings.TrimSpace(line), ":"), `"`)
+			continue
+		}
+		if match := podfileLockPathSourceExp.FindStringSubmatch(line); match != nil && pod != "" {
+			sources[pod] = match[1]
+		}
+	}
+
+	return sources
+}
+
+func checkLocalPathPods(podfileLockContent, podfileDir string) PreflightResult {
+	const check = "Local path pods"
+
+	sources := parsePodfileLockPathSources(podfileLockContent)
+
+	var missing []string
+	for pod, pth := range sources {
+		if !filepath.IsAbs(pth) {
+			pth = filepath.Join(podfileDir, pth)
+		}
+		if !isPathExists(pth) {
+			missing = append(missing, fmt.Sprintf("%s (%s)", pod, pth))
+		}
+	}
+
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return PreflightResult{
+			Check:   check,
+			Status:  PreflightStatusFail,
+			Message: "the directory of :path pods does not exist: " + strings.Join(missing, ", "),
+			Hint:    "Make sure the directories are committed or generated before this step (for example by npm install or flutter pub get).",
+		}
+	}
+	return preflightPassed(check, fmt.Sprintf("%d :path pods found", len(sources)))
+}
+
+func checkPodfileLockMajorVersion(podfileLockVersion, requiredVersion string) PreflightResult {
+	const check = "Podfile.lock CocoaPods version"
+
+	if podfileLockVersion == "" {
+		return preflightPassed(check, "no CocoaPods version in the Podfile.lock")
+	}
+	if requiredVersion == "" {
+		return PreflightResult{
+			Check:   check,
+			Status:  PreflightStatusWarn,
+			Message: fmt.Sprintf("the Podfile.lock was written by CocoaPods %s, the version of the system installed CocoaPods is not checked", podfileLockVersion),
+			Hint:    "Add CocoaPods to the Gemfile.lock, or use the version_source input to install the Podfile.lock's version.",
+		}
+	}
+
+	lockMajor, err := versionSegment(strings.Split(podfileLockVersion, "."), 0)
+	if err != nil {
+		return PreflightResult{Check: check, Status: PreflightStatusWarn, Message: fmt.Sprintf("invalid Podfile.lock version: %s", podfileLockVersion)}
+	}
+	requiredMajor, err := versionSegment(strings.Split(requiredVersion, "."), 0)
+	if err != nil {
+		return PreflightResult{Check: check, Status: PreflightStatusWarn, Message: fmt.Sprintf("invalid CocoaPods version: %s", requiredVersion)}
+	}
+
+	if lockMajor > requiredMajor {
+		return PreflightResult{
+			Check:   check,
+			Status:  PreflightStatusFail,
+			Message: fmt.Sprintf("the Podfile.lock was written by CocoaPods %s, but %s will run", podfileLockVersion, requiredVersion),
+			Hint:    "Update the CocoaPods version in the Gemfile.lock, or use the version_source input to install the Podfile.lock's version.",
+		}
+	}
+	return preflightPassed(check, fmt.Sprintf("the Podfile.lock was written by CocoaPods %s, %s will run", podfileLockVersion, requiredVersion))
+}
+
+func isUTF8Locale(locale string) bool {
+	locale = strings.ToLower(locale)
+	return strings.Contains(locale, "utf-8") || strings.Contains(locale, "utf8")
+}
+
+// checkLocale checks the effective locale: LC_ALL overrides LC_CTYPE, which overrides LANG.
+func checkLocale(env func(string) string) PreflightResult {
+	const check = "UTF-8 locale"
+	const hint = "Set LANG=en_US.UTF-8 (and LC_ALL if it is set) in the workflow's environment."
+
+	for _, key := range []string{"LC_ALL", "LC_CTYPE", "LANG"} {
+		value := env(key)
+		if value == "" {
+			continue
+		}
+		if isUTF8Locale(value) {
+			return preflightPassed(check, fmt.Sprintf("%s=%s", key, value))
+		}
+		return PreflightResult{
+			Check:   check,
+			Status:  PreflightStatusFail,
+			Message: fmt.Sprintf("%s=%s is not a UTF-8 locale, CocoaPods crashes with encoding errors", key, value),
+			Hint:    hint,
+		}
+	}
+
+	return PreflightResult{Check: check, Status: PreflightStatusWarn, Message: "LANG is not set, CocoaPods requires a UTF-8 locale", Hint: hint}
+}
+
+// freeDiskSpace returns the space available to the current user on the volume of the dir, in bytes.
+func freeDiskSpace(dir string) (uint64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(dir, &stat); err != nil {
+		return 0, err
+	}
+	return uint64(stat.Bavail) * uint64(stat.Bsize), nil
+}
+
+func checkFreeDiskSpace(free uint64, dir string) PreflightResult {
+	const check = "Free disk space"
+
+	message := fmt.Sprintf("%.1f GB free on the volume of %s", float64(free)/(1<<30), dir)
+	hint := "Remove unused files (for example old simulators, DerivedData or caches) before this step."
+	switch {
+	case free < preflightDiskSpaceFailLimit:
+		return PreflightResult{Check: check, Status: PreflightStatusFail, Message: message, Hint: hint}
+	case free < preflightDiskSpaceWarnLimit:
+		return PreflightResult{Check: check, Status: PreflightStatusWarn, Message: message, Hint: hint}
+	}
+	return preflightPassed(check, message)
+}
+
+func checkPodsManifest(podfileDir string) PreflightResult {
+	const check = "Pods directory"
+
+	podsDir := filepath.Join(podfileDir, "Pods")
+	if !isPathExists(podsDir) {
+		return preflightPassed(check, "no Pods directory")
+	}
+	if !isPathExists(filepath.Join(podsDir, "Manifest.lock")) {
+		return PreflightResult{
+			Check:   check,
+			Status:  PreflightStatusWarn,
+			Message: fmt.Sprintf("%s exists without a Manifest.lock, pod install reinstalls every pod", podsDir),
+			Hint:    "Commit the whole Pods directory including Manifest.lock, or do not commit or cache it partially.",
+		}
+	}
+	return preflightPassed(check, "Pods directory has a Manifest.lock")
+}
+
+// runPreflightChecks runs the fast checks, which catch the common problems before any gem or pod command runs.
+func runPreflightChecks(input PreflightInput) []PreflightResult {
+	results := []PreflightResult{checkMergeConflictMarkers(input.PodfilePth, input.PodfileLockPth, input.GemfileLockPth)}
+
+	if input.PodfileLockPth != "" && isPathExists(input.PodfileLockPth) {
+		content, err := fileutil.ReadStringFromFile(input.PodfileLockPth)
+		if err != nil {
+			results = append(results, PreflightResult{Check: "Local path pods", Status: PreflightStatusWarn, Message: fmt.Sprintf("failed to read %s: %s", input.PodfileLockPth, err)})
+		} else {
+			results = append(results,
+				checkLocalPathPods(content, input.PodfileDir),
+				checkPodfileLockMajorVersion(cocoapodsVersionFromPodfileLockContent(content), input.RequiredVersion),
+			)
+		}
+	}
+
+	results = append(results, checkLocale(input.Env))
+
+	if free, err := input.FreeDiskSpace(input.PodfileDir); err != nil {
+		results = append(results, PreflightResult{Check: "Free disk space", Status: PreflightStatusWarn, Message: fmt.Sprintf("failed to get free disk space: %s", err)})
+	} else {
+		results = append(results, checkFreeDiskSpace(free, input.PodfileDir))
+	}
+
+	return append(results, checkPodsManifest(input.PodfileDir))
+}
+
+// printPreflightResults logs the results and returns if any of them failed.
+func printPreflightResults(results []PreflightResult) bool {
+	failed := false
+	for _, result := range results {
+		line := fmt.Sprintf("[%s] %s: %s", result.Status, result.Check, result.Message)
+		switch result.Status {
+		case PreflightStatusPass:
+			log.Donef("%s", line)
+		case PreflightStatusWarn:
+			log.Warnf("%s", line)
+		case PreflightStatusFail:
+			failed = true
+			log.Errorf("%s", line)
+		}
+		if result.Hint != "" {
+			log.Printf("  Hint: %s", result.Hint)
+		}
+	}
+	return failed
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testPreflightPodfileLock = `PODS:
+  - Alamofire (5.4.0)
+  - LocalPod (1.0.0)
+
+DEPENDENCIES:
+  - Alamofire
+  - LocalPod (from ` + "`../LocalPod`" + `)
+
+EXTERNAL SOURCES:
+  LocalPod:
+    :path: "../LocalPod"
+  "React-Core":
+    :path: "../node_modules/react-native/"
+  GitPod:
+    :git: https://github.com/example/GitPod.git
+
+COCOAPODS: 1.11.3
+`
+
+func TestMergeConflictMarkerLines(t *testing.T) {
+	content := "PODS:\n<<<<<<< HEAD\n  - Alamofire (5.4.0)\n=======\n  - Alamofire (5.5.0)\n>>>>>>> feature\n"
+	require.Equal(t, []int{2, 4, 6}, mergeConflictMarkerLines(content))
+	require.Nil(t, mergeConflictMarkerLines("PODS:\n  - Alamofire (5.4.0)\n# ========\n"))
+}
+
+func TestParsePodfileLockPathSources(t *testing.T) {
+	require.Equal(t, map[string]string{
+		"LocalPod":   "../LocalPod",
+		"React-Core": "../node_modules/react-native/",
+	}, parsePodfileLockPathSources(testPreflightPodfileLock))
+	require.Equal(t, map[string]string{}, parsePodfileLockPathSources("PODS:\n  - Alamofire (5.4.0)\n"))
+}
+
+func TestCheckLocalPathPods(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "preflight")
+	require.NoError(t, err)
+	defer func() { require.NoError(t, os.RemoveAll(tmpDir)) }()
+
+	podfileDir := filepath.Join(tmpDir, "ios")
+	require.NoError(t, os.MkdirAll(podfileDir, 0755))
+	require.NoError(t, os.MkdirAll(filepath.Join(tmpDir, "LocalPod"), 0755))
+
+	t.Log("missing path pod")
+	{
+		result := checkLocalPathPods(testPreflightPodfileLock, podfileDir)
+		require.Equal(t, PreflightStatusFail, result.Status)
+		require.Contains(t, result.Message, "React-Core")
+		require.NotContains(t, result.Message, "LocalPod")
+	}
+
+	t.Log("all path pods exist")
+	{
+		require.NoError(t, os.MkdirAll(filepath.Join(tmpDir, "node_modules", "react-native"), 0755))
+		require.Equal(t, PreflightStatusPass, checkLocalPathPods(testPreflightPodfileLock, podfileDir).Status)
+	}
+}
+
+func TestCheckPodfileLockMajorVersion(t *testing.T) {
+	require.Equal(t, PreflightStatusFail, checkPodfileLockMajorVersion("2.0.0", "1.11.3").Status)
+	require.Equal(t, PreflightStatusPass, checkPodfileLockMajorVersion("1.12.0", "1.11.3").Status)
+	require.Equal(t, PreflightStatusPass, checkPodfileLockMajorVersion("1.11.3", "2.0.0.beta.1").Status)
+	require.Equal(t, PreflightStatusWarn, checkPodfileLockMajorVersion("1.11.3", "").Status)
+	require.Equal(t, PreflightStatusPass, checkPodfileLockMajorVersion("", "1.11.3").Status)
+	require.Equal(t, PreflightStatusWarn, checkPodfileLockMajorVersion("x.1", "1.11.3").Status)
+}
+
+func TestCheckLocale(t *testing.T) {
+	env := func(envs map[string]string) func(string) string {
+		return func(key string) string { return envs[key] }
+	}
+
+	require.Equal(t, PreflightStatusPass, checkLocale(env(map[string]string{"LANG": "en_US.UTF-8"})).Status)
+	require.Equal(t, PreflightStatusPass, checkLocale(env(map[string]string{"LANG": "C", "LC_ALL": "en_US.utf8"})).Status)
+	require.Equal(t, PreflightStatusFail, checkLocale(env(map[string]string{"LANG": "en_US.UTF-8", "LC_ALL": "C"})).Status)
+	require.Equal(t, PreflightStatusFail, checkLocale(env(map[string]string{"LANG": "en_US.ISO-8859-1"})).Status)
+	require.Equal(t, PreflightStatusWarn, checkLocale(env(map[string]string{})).Status)
+}
+
+func TestCheckFreeDiskSpace(t *testing.T) {
+	require.Equal(t, PreflightStatusPass, checkFreeDiskSpace(20<<30, "/").Status)
+	require.Equal(t, PreflightStatusWarn, checkFreeDiskSpace(2<<30, "/").Status)
+	require.Equal(t, PreflightStatusFail, checkFreeDiskSpace(512<<20, "/").Status)
+}
+
+func TestCheckPodsManifest(t *testing.T) {
+	podfileDir, err := ioutil.TempDir("", "preflight")
+	require.NoError(t, err)
+	defer func() { require.NoError(t, os.RemoveAll(podfileDir)) }()
+
+	require.Equal(t, PreflightStatusPass, checkPodsManifest(podfileDir).Status)
+
+	require.NoError(t, os.MkdirAll(filepath.Join(podfileDir, "Pods"), 0755))
+	require.Equal(t, PreflightStatusWarn, checkPodsManifest(podfileDir).Status)
+
+	require.NoError(t, ioutil.WriteFile(filepath.Join(podfileDir, "Pods", "Manifest.lock"), []byte(""), 0644))
+	require.Equal(t, PreflightStatusPass, checkPodsManifest(podfileDir).Status)
+}
+
+func TestRunPreflightChecks(t *testing.T) {
+	podfileDir, err := ioutil.TempDir("", "preflight")
+	require.NoError(t, err)
+	defer func() { require.NoError(t, os.RemoveAll(podfileDir)) }()
+
+	podfileLockPth := filepath.Join(podfileDir, "Podfile.lock")
+	require.NoError(t, ioutil.WriteFile(podfileLockPth, []byte("PODS:\n  - Alamofire (5.4.0)\n\nCOCOAPODS: 1.11.3\n"), 0644))
+
+	results := runPreflightChecks(PreflightInput{
+		PodfileDir:      podfileDir,
+		PodfilePth:      filepath.Join(podfileDir, "Podfile"),
+		PodfileLockPth:  podfileLockPth,
+		RequiredVersion: "1.11.3",
+		Env:             func(string) string { return "en_US.UTF-8" },
+		FreeDiskSpace:   func(string) (uint64, error) { return 0, errors.New("statfs failed") },
+	})
+
+	var statuses []PreflightStatus
+	for _, result := range results {
+		statuses = append(statuses, result.Status)
+	}
+	require.Equal(t, []PreflightStatus{
+		PreflightStatusPass, // merge conflict markers
+		PreflightStatusPass, // local path pods
+		PreflightStatusPass, // Podfile.lock CocoaPods version
+		PreflightStatusPass, // locale
+		PreflightStatusWarn, // free disk space
+		PreflightStatusPass, // Pods directory
+	}, statuses)
+}
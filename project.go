@@ -0,0 +1,248 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/bitrise-io/bitrise-init/utility"
+	"github.com/bitrise-io/go-utils/command"
+	"github.com/bitrise-io/go-utils/log"
+	"github.com/bitrise-io/go-utils/pathutil"
+)
+
+// ProjectType is the type of the project the Podfile belongs to.
+type ProjectType string
+
+// ProjectTypes ...
+const (
+	ProjectTypeNative      ProjectType = "native"
+	ProjectTypeReactNative ProjectType = "react-native"
+	ProjectTypeFlutter     ProjectType = "flutter"
+	ProjectTypeIonic       ProjectType = "ionic"
+	ProjectTypeCordova     ProjectType = "cordova"
+)
+
+// ProjectPreconditionMode is what to do if a generated input of the Podfile is missing.
+type ProjectPreconditionMode string
+
+// ProjectPreconditionModes ...
+const (
+	ProjectPreconditionModeWarn ProjectPreconditionMode = "warn"
+	ProjectPreconditionModeFail ProjectPreconditionMode = "fail"
+	ProjectPreconditionModeRun  ProjectPreconditionMode = "run"
+	ProjectPreconditionModeSkip ProjectPreconditionMode = "skip"
+)
+
+// Project is the cross-platform (or native) project the Podfile belongs to.
+type Project struct {
+	Type    ProjectType
+	RootDir string
+}
+
+// Precondition is a generated input of the Podfile, which needs to exist before running pod install.
+type Precondition struct {
+	Path    string
+	Command []string
+	Dir     string
+}
+
+// projectRootSearchDepth is how many parents of the Podfile dir are checked for the project root,
+// for example the Podfile of a Capacitor project is located at ios/App/Podfile.
+const projectRootSearchDepth = 2
+
+func isPathExists(pth string) bool {
+	exist, err := pathutil.IsPathExists(pth)
+	return err == nil && exist
+}
+
+func hasDependency(packages utility.PackagesModel, name string) bool {
+	if _, ok := packages.Dependencies[name]; ok {
+		return true
+	}
+	_, ok := packages.DevDependencies[name]
+	return ok
+}
+
+// detectProject returns the project type, based on the package.json or pubspec.yaml found next to or above the Podfile.
+func detectProject(podfileDir string) (Project, error) {
+	dir := podfileDir
+	for i := 0; i <= projectRootSearchDepth; i++ {
+		if isPathExists(filepath.Join(dir, "pubspec.yaml")) {
+			return Project{Type: ProjectTypeFlutter, RootDir: dir}, nil
+		}
+
+		packageJSONPth := filepath.Join(dir, "package.json")
+		if isPathExists(packageJSONPth) {
+			packages, err := utility.ParsePackagesJSON(packageJSONPth)
+			if err != nil {
+				return Project{}, fmt.Errorf("failed to parse %s, error: %s", packageJSONPth, err)
+			}
+
+			switch {
+			case hasDependency(packages, "react-native"):
+				return Project{Type: ProjectTypeReactNative, RootDir: dir}, nil
+			case hasDependency(packages, "@capacitor/ios"):
+				return Project{Type: ProjectTypeIonic, RootDir: dir}, nil
+			case hasDependency(packages, "cordova-ios"):
+				return Project{Type: ProjectTypeCordova, RootDir: dir}, nil
+			}
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		dir = parent
+	}
+
+	return Project{Type: ProjectTypeNative, RootDir: podfileDir}, nil
+}
+
+// nodePackageInstallCommand returns the package manager install command matching the committed lockfile.
+func nodePackageInstallCommand(rootDir string) []string {
+	if isPathExists(filepath.Join(rootDir, "yarn.lock")) {
+		return []string{"yarn", "install", "--frozen-lockfile"}
+	}
+	if isPathExists(filepath.Join(rootDir, "package-lock.json")) {
+		return []string{"npm", "ci"}
+	}
+	return []string{"npm", "install"}
+}
+
+// projectPreconditions returns the generated inputs the Podfile of the project requires.
+func projectPreconditions(project Project, podfileDir string) []Precondition {
+	switch project.Type {
+	case ProjectTypeReactNative:
+		return []Precondition{{
+			Path:    filepath.Join(project.RootDir, "node_modules", "react-native"),
+			Command: nodePackageInstallCommand(project.RootDir),
+			Dir:     project.RootDir,
+		}}
+	case ProjectTypeIonic:
+		return []Precondition{{
+			Path:    filepath.Join(project.RootDir, "node_modules", "@capacitor", "ios"),
+			Command: nodePackageInstallCommand(project.RootDir),
+			Dir:     project.RootDir,
+		}}
+	case ProjectTypeCordova:
+		// cordova prepare adds the iOS platform, and installs the plugins whose pods are added to the platform's Podfile
+		return []Precondition{
+			{
+				Path:    filepath.Join(project.RootDir, "node_modules", "cordova-ios"),
+				Command: nodePackageInstallCommand(project.RootDir),
+				Dir:     project.RootDir,
+			},
+			{
+				Path:    filepath.Join(project.RootDir, "platforms", "ios"),
+				Command: []string{"cordova", "prepare", "ios"},
+				Dir:     project.RootDir,
+			},
+			{
+				Path:    filepath.Join(project.RootDir, "plugins"),
+				Command: []string{"cordova", "prepare", "ios"},
+				Dir:     project.RootDir,
+			},
+		}
+	case ProjectTypeFlutter:
+		// the .symlinks/plugins dir is created by Flutter's podhelper during pod install,
+		// based on the .flutter-plugins-dependencies file generated by flutter pub get
+		generatedXcconfigPth := filepath.Join(podfileDir, "Flutter", "Generated.xcconfig")
+		if filepath.Base(podfileDir) == "macos" {
+			generatedXcconfigPth = filepath.Join(podfileDir, "Flutter", "ephemeral", "Flutter-Generated.xcconfig")
+		}
+
+		return []Precondition{
+			{
+				Path:    generatedXcconfigPth,
+				Command: []string{"flutter", "pub", "get"},
+				Dir:     project.RootDir,
+			},
+			{
+				Path:    filepath.Join(project.RootDir, ".flutter-plugins-dependencies"),
+				Command: []string{"flutter", "pub", "get"},
+				Dir:     project.RootDir,
+			},
+		}
+	}
+
+	return nil
+}
+
+// missingPreconditions returns the preconditions whose generated input does not exist.
+func missingPreconditions(preconditions []Precondition) []Precondition {
+	var missing []Precondition
+	for _, precondition := range preconditions {
+		if !isPathExists(precondition.Path) {
+			missing = append(missing, precondition)
+		}
+	}
+	return missing
+}
+
+// checkProjectPreconditions checks the generated inputs of the Podfile, and warns, fails or runs the commands generating them
+// depending on the mode. If the project type can not be detected, it is treated as a native project, unless the mode is fail.
+func checkProjectPreconditions(podfileDir string, mode ProjectPreconditionMode) error {
+	if mode == ProjectPreconditionModeSkip {
+		return nil
+	}
+
+	fmt.Println()
+	log.Infof("Checking project preconditions")
+
+	project, err := detectProject(podfileDir)
+	if err != nil {
+		if mode == ProjectPreconditionModeFail {
+			return fmt.Errorf("failed to detect project type, error: %s", err)
+		}
+		log.Warnf("Failed to detect project type, error: %s", err)
+		project = Project{Type: ProjectTypeNative, RootDir: podfileDir}
+	}
+
+	log.Printf("Project type: %s (%s)", project.Type, project.RootDir)
+
+	missing := missingPreconditions(projectPreconditions(project, podfileDir))
+	ran := map[string]bool{}
+	for _, precondition := range missing {
+		printableCommand := command.PrintableCommandArgs(false, precondition.Command)
+		message := fmt.Sprintf("%s not found, run `%s` in %s before this step, or set the project_precondition_mode input to run", precondition.Path, printableCommand, precondition.Dir)
+
+		switch mode {
+		case ProjectPreconditionModeFail:
+			return fmt.Errorf("%s", message)
+		case ProjectPreconditionModeRun:
+		default:
+			log.Warnf("%s", message)
+			continue
+		}
+
+		if ran[printableCommand] {
+			continue
+		}
+		ran[printableCommand] = true
+
+		log.Warnf("%s not found", precondition.Path)
+
+		cmd, err := command.NewFromSlice(precondition.Command)
+		if err != nil {
+			return fmt.Errorf("failed to create command model, error: %s", err)
+		}
+
+		cmd.SetStdout(os.Stdout).SetStderr(os.Stderr)
+		cmd.SetDir(precondition.Dir)
+
+		log.Donef("$ %s", redactSecrets(cmd.PrintableCommandArgs()))
+		if err := runCommand(cmd); err != nil {
+			return fmt.Errorf("command failed, error: %s", err)
+		}
+	}
+
+	if stillMissing := missingPreconditions(missing); mode == ProjectPreconditionModeRun && len(stillMissing) > 0 {
+		return fmt.Errorf("%s not found after running `%s`", stillMissing[0].Path, command.PrintableCommandArgs(false, stillMissing[0].Command))
+	}
+
+	if len(missing) == 0 {
+		log.Donef("All the generated inputs of the Podfile exist")
+	}
+	return nil
+}
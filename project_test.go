@@ -0,0 +1,133 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func createFile(t *testing.T, pth, content string) {
+	require.NoError(t, os.MkdirAll(filepath.Dir(pth), 0755))
+	require.NoError(t, ioutil.WriteFile(pth, []byte(content), 0644))
+}
+
+func TestDetectProject(t *testing.T) {
+	dir, err := ioutil.TempDir("", "project")
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, os.RemoveAll(dir))
+	}()
+
+	t.Log("react native")
+	{
+		root := filepath.Join(dir, "rn")
+		createFile(t, filepath.Join(root, "package.json"), `{"dependencies": {"react-native": "0.64.0"}}`)
+		createFile(t, filepath.Join(root, "yarn.lock"), "")
+		createFile(t, filepath.Join(root, "ios", "Podfile"), "")
+
+		project, err := detectProject(filepath.Join(root, "ios"))
+		require.NoError(t, err)
+		require.Equal(t, Project{Type: ProjectTypeReactNative, RootDir: root}, project)
+		require.Equal(t, []Precondition{{
+			Path:    filepath.Join(root, "node_modules", "react-native"),
+			Command: []string{"yarn", "install", "--frozen-lockfile"},
+			Dir:     root,
+		}}, missingPreconditions(projectPreconditions(project, filepath.Join(root, "ios"))))
+
+		createFile(t, filepath.Join(root, "node_modules", "react-native", "package.json"), "{}")
+		require.Equal(t, 0, len(missingPreconditions(projectPreconditions(project, filepath.Join(root, "ios")))))
+	}
+
+	t.Log("ionic capacitor")
+	{
+		root := filepath.Join(dir, "ionic")
+		createFile(t, filepath.Join(root, "package.json"), `{"dependencies": {"@capacitor/ios": "3.0.0"}}`)
+		createFile(t, filepath.Join(root, "ios", "App", "Podfile"), "")
+
+		project, err := detectProject(filepath.Join(root, "ios", "App"))
+		require.NoError(t, err)
+		require.Equal(t, Project{Type: ProjectTypeIonic, RootDir: root}, project)
+	}
+
+	t.Log("cordova")
+	{
+		root := filepath.Join(dir, "cordova")
+		createFile(t, filepath.Join(root, "package.json"), `{"dependencies": {"cordova-ios": "6.2.0"}}`)
+		createFile(t, filepath.Join(root, "package-lock.json"), "")
+		createFile(t, filepath.Join(root, "platforms", "ios", "Podfile"), "")
+
+		project, err := detectProject(filepath.Join(root, "platforms", "ios"))
+		require.NoError(t, err)
+		require.Equal(t, Project{Type: ProjectTypeCordova, RootDir: root}, project)
+		require.Equal(t, []Precondition{
+			{
+				Path:    filepath.Join(root, "node_modules", "cordova-ios"),
+				Command: []string{"npm", "ci"},
+				Dir:     root,
+			},
+			{
+				Path:    filepath.Join(root, "plugins"),
+				Command: []string{"cordova", "prepare", "ios"},
+				Dir:     root,
+			},
+		}, missingPreconditions(projectPreconditions(project, filepath.Join(root, "platforms", "ios"))))
+	}
+
+	t.Log("flutter")
+	{
+		root := filepath.Join(dir, "flutter")
+		createFile(t, filepath.Join(root, "pubspec.yaml"), "")
+		createFile(t, filepath.Join(root, "ios", "Podfile"), "")
+
+		project, err := detectProject(filepath.Join(root, "ios"))
+		require.NoError(t, err)
+		require.Equal(t, Project{Type: ProjectTypeFlutter, RootDir: root}, project)
+		require.Equal(t, 2, len(missingPreconditions(projectPreconditions(project, filepath.Join(root, "ios")))))
+	}
+
+	t.Log("native")
+	{
+		root := filepath.Join(dir, "native")
+		createFile(t, filepath.Join(root, "Podfile"), "")
+
+		project, err := detectProject(root)
+		require.NoError(t, err)
+		require.Equal(t, ProjectTypeNative, project.Type)
+		require.Equal(t, 0, len(projectPreconditions(project, root)))
+	}
+}
+
+func TestCheckProjectPreconditions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "project")
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, os.RemoveAll(dir))
+	}()
+
+	t.Log("missing node_modules")
+	{
+		root := filepath.Join(dir, "rn")
+		createFile(t, filepath.Join(root, "package.json"), `{"dependencies": {"react-native": "0.64.0"}}`)
+		createFile(t, filepath.Join(root, "ios", "Podfile"), "")
+
+		podfileDir := filepath.Join(root, "ios")
+		require.NoError(t, checkProjectPreconditions(podfileDir, ProjectPreconditionModeSkip))
+		require.NoError(t, checkProjectPreconditions(podfileDir, ProjectPreconditionModeWarn))
+		require.NoError(t, checkProjectPreconditions(podfileDir, ""))
+		require.Error(t, checkProjectPreconditions(podfileDir, ProjectPreconditionModeFail))
+	}
+
+	t.Log("native project next to an invalid package.json")
+	{
+		root := filepath.Join(dir, "native")
+		createFile(t, filepath.Join(root, "package.json"), `{`)
+		createFile(t, filepath.Join(root, "ios", "Podfile"), "")
+
+		podfileDir := filepath.Join(root, "ios")
+		require.NoError(t, checkProjectPreconditions(podfileDir, ProjectPreconditionModeWarn))
+		require.Error(t, checkProjectPreconditions(podfileDir, ProjectPreconditionModeFail))
+	}
+}
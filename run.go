@@ -0,0 +1,241 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/bitrise-io/go-utils/command"
+	"github.com/bitrise-io/go-utils/log"
+)
+
+const (
+	commandOutputTailLines = 20
+	commandKillGracePeriod = 10 * time.Second
+	commandWatchInterval   = time.Second
+	cleanupCommandTimeout  = time.Minute
+)
+
+// CommandTimeouts configures the watchdog of the commands started by the step.
+type CommandTimeouts struct {
+	// Timeout is the overall timeout of a single command, 0 means no timeout.
+	Timeout time.Duration
+	// InactivityTimeout is the maximum time a command can run without printing any output, 0 means no timeout.
+	InactivityTimeout time.Duration
+	// HeartbeatInterval is how often the step logs that a silent command is still running, 0 disables the heartbeat.
+	HeartbeatInterval time.Duration
+}
+
+var commandTimeouts = CommandTimeouts{HeartbeatInterval: time.Minute}
+
+// CommandTimeoutError is returned if a command was killed by the watchdog.
+type CommandTimeoutError struct {
+	Command string
+	Reason  string
+	Tail    []string
+}
+
+func (e *CommandTimeoutError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Command, e.Reason)
+}
+
+// activityWriter records the time of the last output and keeps the last lines of it.
+type activityWriter struct {
+	mu           sync.Mutex
+	lastActivity time.Time
+	partial      string
+	tail         []string
+}
+
+func newActivityWriter() *activityWriter {
+	return &activityWriter{lastActivity: time.Now()}
+}
+
+func (w *activityWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.lastActivity = time.Now()
+
+	lines := strings.Split(w.partial+string(p), "\n")
+	w.partial = lines[len(lines)-1]
+	w.tail = append(w.tail, lines[:len(lines)-1]...)
+	if len(w.tail) > commandOutputTailLines {
+		w.tail = w.tail[len(w.tail)-commandOutputTailLines:]
+	}
+
+	return len(p), nil
+}
+
+func (w *activityWriter) lastActivityTime() time.Time {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.lastActivity
+}
+
+func (w *activityWriter) lastLines() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	lines := append([]string{}, w.tail...)
+	if w.partial != "" {
+		lines = append(lines, w.partial)
+	}
+	if len(lines) > commandOutputTailLines {
+		lines = lines[len(lines)-commandOutputTailLines:]
+	}
+	return lines
+}
+
+func teeWriter(w io.Writer, activity *activityWriter) io.Writer {
+	if w == nil {
+		return activity
+	}
+	return io.MultiWriter(w, activity)
+}
+
+// runCommand runs the command under the watchdog configured by commandTimeouts.
+// On timeout the command's whole process group is killed, and a *CommandTimeoutError is returned.
+func runCommand(cmd *command.Model) error {
+	return runCommandWithTimeouts(cmd, commandTimeouts)
+}
+
+func runCommandWithTimeouts(cmd *command.Model, timeouts CommandTimeouts) error {
+	return runWatchedCommand(cmd, timeouts, true)
+}
+
+// runCleanupCommand runs a command restoring the environment, it is called from the cleanup functions.
+// Unlike runCommand it also runs after an interrupt, as the cleanups are run by the interrupt handler itself.
+func runCleanupCommand(cmd *command.Model) error {
+	return runWatchedCommand(cmd, CommandTimeouts{Timeout: cleanupCommandTimeout}, false)
+}
+
+// runWatchedCommand runs the command under the watchdog.
+// If blockOnInterrupt is set, the calling goroutine is blocked after an interrupt, until the interrupt handler exits the step.
+func runWatchedCommand(cmd *command.Model, timeouts CommandTimeouts, blockOnInterrupt bool) error {
+	execCmd := cmd.GetCmd()
+	printableCmd := redactSecrets(cmd.PrintableCommandArgs())
+
+	activity := newActivityWriter()
+	execCmd.Stdout = teeWriter(execCmd.Stdout, activity)
+	execCmd.Stderr = teeWriter(execCmd.Stderr, activity)
+
+	// run the command in its own process group, so that its child processes can be killed too
+	if execCmd.SysProcAttr == nil {
+		execCmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	execCmd.SysProcAttr.Setpgid = true
+
+	if blockOnInterrupt && isInterrupted() {
+		waitForInterruptHandler()
+	}
+
+	if err := execCmd.Start(); err != nil {
+		return err
+	}
+	registerRunningCommand(execCmd.Process.Pid)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- execCmd.Wait()
+	}()
+
+	start := time.Now()
+	lastHeartbeat := start
+	ticker := time.NewTicker(commandWatchInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case err := <-done:
+			unregisterRunningCommand(execCmd.Process.Pid)
+			if blockOnInterrupt && isInterrupted() {
+				waitForInterruptHandler()
+			}
+			return err
+		case now := <-ticker.C:
+			reason := ""
+			silence := now.Sub(activity.lastActivityTime())
+
+			if timeouts.Timeout > 0 && now.Sub(start) > timeouts.Timeout {
+				reason = fmt.Sprintf("timed out after %s", timeouts.Timeout)
+			} else if timeouts.InactivityTimeout > 0 && silence > timeouts.InactivityTimeout {
+				reason = fmt.Sprintf("no output for %s", timeouts.InactivityTimeout)
+			}
+
+			if reason != "" {
+				log.Errorf("Command %s, killing it: %s", reason, printableCmd)
+				killProcessGroup(execCmd.Process.Pid, done)
+				unregisterRunningCommand(execCmd.Process.Pid)
+
+				tail := activity.lastLines()
+				if len(tail) > 0 {
+					log.Errorf("Last %d lines of the output:", len(tail))
+					for _, line := range tail {
+						log.Printf("%s", redactSecrets(line))
+					}
+				}
+
+				return &CommandTimeoutError{Command: printableCmd, Reason: reason, Tail: tail}
+			}
+
+			if timeouts.HeartbeatInterval > 0 && silence > timeouts.HeartbeatInterval && now.Sub(lastHeartbeat) > timeouts.HeartbeatInterval {
+				log.Printf("Still running (%s elapsed, no output for %s): %s", now.Sub(start).Round(time.Second), silence.Round(time.Second), printableCmd)
+				lastHeartbeat = now
+			}
+		}
+	}
+}
+
+// killProcessGroup sends SIGTERM to the process group, and SIGKILL if it does not exit within the grace period.
+func killProcessGroup(pid int, done <-chan error) {
+	if err := syscall.Kill(-pid, syscall.SIGTERM); err != nil {
+		log.Warnf("Failed to terminate process group (%d), error: %s", pid, err)
+	}
+
+	select {
+	case <-done:
+		return
+	case <-time.After(commandKillGracePeriod):
+	}
+
+	if err := syscall.Kill(-pid, syscall.SIGKILL); err != nil {
+		log.Warnf("Failed to kill process group (%d), error: %s", pid, err)
+	}
+	<-done
+}
+
+var (
+	runningCommandsMu sync.Mutex
+	runningCommands   = map[int]bool{}
+)
+
+func registerRunningCommand(pid int) {
+	runningCommandsMu.Lock()
+	defer runningCommandsMu.Unlock()
+
+	runningCommands[pid] = true
+}
+
+func unregisterRunningCommand(pid int) {
+	runningCommandsMu.Lock()
+	defer runningCommandsMu.Unlock()
+
+	delete(runningCommands, pid)
+}
+
+// runningCommandPids returns the pids (and process group ids) of the running commands.
+func runningCommandPids() []int {
+	runningCommandsMu.Lock()
+	defer runningCommandsMu.Unlock()
+
+	var pids []int
+	for pid := range runningCommands {
+		pids = append(pids, pid)
+	}
+	return pids
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/bitrise-io/go-utils/command"
+	"github.com/stretchr/testify/require"
+)
+
+func TestActivityWriter(t *testing.T) {
+	t.Log("keeps the partial line")
+	{
+		w := newActivityWriter()
+		_, err := w.Write([]byte("first\nsec"))
+		require.NoError(t, err)
+		_, err = w.Write([]byte("ond\nthird"))
+		require.NoError(t, err)
+
+		require.Equal(t, []string{"first", "second", "third"}, w.lastLines())
+	}
+
+	t.Log("keeps the last lines only")
+	{
+		w := newActivityWriter()
+		for i := 0; i < commandOutputTailLines+5; i++ {
+			_, err := w.Write([]byte(fmt.Sprintf("line %d\n", i)))
+			require.NoError(t, err)
+		}
+
+		lines := w.lastLines()
+		require.Equal(t, commandOutputTailLines, len(lines))
+		require.Equal(t, "line 5", lines[0])
+		require.Equal(t, fmt.Sprintf("line %d", commandOutputTailLines+4), lines[len(lines)-1])
+	}
+}
+
+func TestRunCommandWithTimeouts(t *testing.T) {
+	t.Log("command finishes")
+	{
+		var output bytes.Buffer
+		cmd := command.New("sh", "-c", "echo hello").SetStdout(&output)
+
+		require.NoError(t, runCommandWithTimeouts(cmd, CommandTimeouts{Timeout: 10 * time.Second}))
+		require.Equal(t, "hello\n", output.String())
+	}
+
+	t.Log("command fails")
+	{
+		cmd := command.New("sh", "-c", "exit 1")
+
+		err := runCommandWithTimeouts(cmd, CommandTimeouts{})
+		require.Error(t, err)
+		_, isTimeout := err.(*CommandTimeoutError)
+		require.False(t, isTimeout)
+	}
+
+	t.Log("overall timeout")
+	{
+		cmd := command.New("sh", "-c", "while true; do echo tick; sleep 0.2; done")
+
+		start := time.Now()
+		err := runCommandWithTimeouts(cmd, CommandTimeouts{Timeout: 2 * time.Second})
+		require.Error(t, err)
+		require.True(t, time.Since(start) < 10*time.Second)
+
+		timeoutErr, ok := err.(*CommandTimeoutError)
+		require.True(t, ok)
+		require.Contains(t, timeoutErr.Reason, "timed out")
+		require.Contains(t, timeoutErr.Tail, "tick")
+	}
+
+	t.Log("inactivity timeout kills the child processes too")
+	{
+		cmd := command.New("sh", "-c", "echo started; sleep 60 & wait")
+
+		start := time.Now()
+		err := runCommandWithTimeouts(cmd, CommandTimeouts{InactivityTimeout: time.Second})
+		require.Error(t, err)
+		require.True(t, time.Since(start) < 10*time.Second)
+
+		timeoutErr, ok := err.(*CommandTimeoutError)
+		require.True(t, ok)
+		require.Contains(t, timeoutErr.Reason, "no output")
+		require.Equal(t, []string{"started"}, timeoutErr.Tail)
+	}
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitShellWords(t *testing.T) {
+	t.Log("simple words")
+	{
+		words, err := splitShellWords("--clean-install  --repo-update\n--verbose")
+		require.NoError(t, err)
+		require.Equal(t, []string{"--clean-install", "--repo-update", "--verbose"}, words)
+	}
+
+	t.Log("quotes and escapes")
+	{
+		words, err := splitShellWords(`--project-directory="my project/ios" A='single "quoted"' B=escaped\ space C="with \"escaped\" quotes" ''`)
+		require.NoError(t, err)
+		require.Equal(t, []string{`--project-directory=my project/ios`, `A=single "quoted"`, `B=escaped space`, `C=with "escaped" quotes`, ``}, words)
+	}
+
+	t.Log("unterminated quote")
+	{
+		_, err := splitShellWords(`A="value`)
+		require.Error(t, err)
+	}
+}
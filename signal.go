@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/bitrise-io/go-utils/log"
+)
+
+const interruptPollInterval = 100 * time.Millisecond
+
+var interruptState struct {
+	mu                sync.Mutex
+	interrupted       bool
+	incompletePodsDir string
+}
+
+func isInterrupted() bool {
+	interruptState.mu.Lock()
+	defer interruptState.mu.Unlock()
+
+	return interruptState.interrupted
+}
+
+// setIncompletePodsDir sets the Pods dir being written by the running pod install, an empty dir means no install is running.
+func setIncompletePodsDir(dir string) {
+	interruptState.mu.Lock()
+	defer interruptState.mu.Unlock()
+
+	interruptState.incompletePodsDir = dir
+}
+
+// waitForInterruptHandler blocks the calling goroutine, the interrupt handler exits the step once the cleanup is done.
+func waitForInterruptHandler() {
+	select {}
+}
+
+// handleInterrupts forwards SIGINT and SIGTERM to the running commands' process groups,
+// removes the Pods dir of an interrupted pod install and exits the step, unless the main goroutine is already exiting it.
+// A repeated signal exits the step immediately, without waiting for the cleanup.
+func handleInterrupts(gracePeriod time.Duration) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+
+	go func() {
+		sig := <-signals
+
+		go func() {
+			sig := <-signals
+			log.Errorf("Received %s again, exiting without cleanup", sig)
+			os.Exit(1)
+		}()
+
+		exitMu.Lock()
+		stopOnInterrupt(sig, gracePeriod)
+		log.Errorf("Step interrupted by %s", sig)
+		os.Exit(1)
+	}()
+}
+
+// stopOnInterrupt marks the step interrupted, stops the running commands, removes the incomplete Pods dir
+// and runs the cleanup functions.
+func stopOnInterrupt(sig os.Signal, gracePeriod time.Duration) {
+	interruptState.mu.Lock()
+	interruptState.interrupted = true
+	podsDir := interruptState.incompletePodsDir
+	interruptState.mu.Unlock()
+
+	fmt.Println()
+	log.Warnf("Received %s, stopping the running commands ...", sig)
+
+	if s, ok := sig.(syscall.Signal); ok {
+		forwardSignal(s, gracePeriod)
+	}
+
+	if podsDir != "" {
+		removeIncompletePods(podsDir)
+	}
+
+	runCleanups()
+}
+
+// forwardSignal sends the signal to the running commands' process groups,
+// and kills the ones which do not exit within the grace period.
+func forwardSignal(sig syscall.Signal, gracePeriod time.Duration) {
+	for _, pid := range runningCommandPids() {
+		if err := syscall.Kill(-pid, sig); err != nil {
+			log.Warnf("Failed to forward %s to process group (%d), error: %s", sig, pid, err)
+		}
+	}
+
+	deadline := time.Now().Add(gracePeriod)
+	for len(runningCommandPids()) > 0 && time.Now().Before(deadline) {
+		time.Sleep(interruptPollInterval)
+	}
+
+	for _, pid := range runningCommandPids() {
+		log.Warnf("Process group (%d) did not exit in %s, killing it", pid, gracePeriod)
+		if err := syscall.Kill(-pid, syscall.SIGKILL); err != nil {
+			log.Warnf("Failed to kill process group (%d), error: %s", pid, err)
+		}
+	}
+}
+
+// removeIncompletePods removes the partially written Pods dir, so that neither the cache nor the next build uses it.
+func removeIncompletePods(podsDir string) {
+	log.Warnf("Removing the incomplete Pods dir: %s", podsDir)
+	if err := os.RemoveAll(podsDir); err != nil {
+		log.Warnf("Failed to remove the incomplete Pods dir, error: %s", err)
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/bitrise-io/go-utils/command"
+	"github.com/stretchr/testify/require"
+)
+
+func TestForwardSignal(t *testing.T) {
+	t.Log("forwards the signal to the command's process group")
+	{
+		cmd := command.New("sh", "-c", "sleep 60 & wait")
+
+		errChan := make(chan error, 1)
+		go func() {
+			errChan <- runCommandWithTimeouts(cmd, CommandTimeouts{})
+		}()
+
+		for len(runningCommandPids()) == 0 {
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		start := time.Now()
+		forwardSignal(syscall.SIGTERM, 5*time.Second)
+		require.True(t, time.Since(start) < 5*time.Second)
+		require.Error(t, <-errChan)
+		require.Equal(t, 0, len(runningCommandPids()))
+	}
+
+	t.Log("kills the process group after the grace period")
+	{
+		cmd := command.New("sh", "-c", "trap '' TERM; while true; do sleep 0.1; done")
+
+		errChan := make(chan error, 1)
+		go func() {
+			errChan <- runCommandWithTimeouts(cmd, CommandTimeouts{})
+		}()
+
+		for len(runningCommandPids()) == 0 {
+			time.Sleep(10 * time.Millisecond)
+		}
+		// let the shell install its trap
+		time.Sleep(200 * time.Millisecond)
+
+		forwardSignal(syscall.SIGTERM, time.Second)
+		require.Error(t, <-errChan)
+	}
+}
+
+func TestRemoveIncompletePods(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "pods")
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, os.RemoveAll(tmpDir))
+	}()
+
+	podsDir := filepath.Join(tmpDir, "Pods")
+	require.NoError(t, os.MkdirAll(filepath.Join(podsDir, "Alamofire"), 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(podsDir, "Manifest.lock"), []byte("PODS:"), 0644))
+
+	removeIncompletePods(podsDir)
+	require.False(t, isPathExists(podsDir))
+}
+
+func TestStopOnInterrupt(t *testing.T) {
+	defer func() {
+		interruptState.mu.Lock()
+		interruptState.interrupted = false
+		interruptState.mu.Unlock()
+	}()
+
+	tmpDir, err := ioutil.TempDir("", "interrupt")
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, os.RemoveAll(tmpDir))
+	}()
+
+	restoredPth := filepath.Join(tmpDir, "restored")
+	registerCleanup(func() {
+		cmd := command.New("sh", "-c", "echo restored > "+restoredPth)
+		require.NoError(t, runCleanupCommand(cmd))
+	})
+
+	done := make(chan bool, 1)
+	go func() {
+		stopOnInterrupt(syscall.SIGTERM, time.Second)
+		done <- true
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("the cleanup command blocked after the interrupt")
+	}
+
+	require.True(t, isInterrupted())
+	require.True(t, isPathExists(restoredPth))
+}
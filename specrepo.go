@@ -0,0 +1,539 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/bitrise-io/go-steputils/command/rubycommand"
+	"github.com/bitrise-io/go-utils/command"
+	"github.com/bitrise-io/go-utils/fileutil"
+	"github.com/bitrise-io/go-utils/log"
+	"github.com/bitrise-io/go-utils/pathutil"
+	"github.com/bitrise-io/go-utils/sliceutil"
+)
+
+// SpecRepo is a CocoaPods spec repository which needs to be added before running pod install.
+type SpecRepo struct {
+	Name string
+	URL  string
+	// Revision is an optional branch name or commit hash.
+	Revision string
+}
+
+var commitHashExp = regexp.MustCompile(`^[0-9a-f]{7,40}$`)
+
+// IsCommitRevision returns true if the repo's revision looks like a commit hash instead of a branch name.
+func (repo SpecRepo) IsCommitRevision() bool {
+	return commitHashExp.MatchString(repo.Revision)
+}
+
+// parseSpecRepos parses the spec_repos input, one repo per line in NAME URL [BRANCH|COMMIT] format.
+func parseSpecRepos(input string) ([]SpecRepo, error) {
+	var repos []SpecRepo
+	names := map[string]bool{}
+
+	for _, line := range strings.Split(input, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) < 2 || len(fields) > 3 {
+			return nil, fmt.Errorf("invalid spec repo: %s, expected format: NAME URL [BRANCH|COMMIT]", line)
+		}
+
+		repo := SpecRepo{Name: fields[0], URL: fields[1]}
+		if len(fields) == 3 {
+			repo.Revision = fields[2]
+		}
+
+		if names[repo.Name] {
+			return nil, fmt.Errorf("spec repo (%s) specified multiple times", repo.Name)
+		}
+		names[repo.Name] = true
+
+		repos = append(repos, repo)
+	}
+
+	return repos, nil
+}
+
+// specReposDir returns the directory where CocoaPods stores the spec repos.
+func specReposDir() string {
+	if dir := os.Getenv("CP_REPOS_DIR"); dir != "" {
+		return dir
+	}
+
+	home := os.Getenv("CP_HOME_DIR")
+	if home == "" {
+		home = filepath.Join(pathutil.UserHomeDir(), ".cocoapods")
+	}
+	return filepath.Join(home, "repos")
+}
+
+func isSpecRepoAdded(name string) (bool, error) {
+	return pathutil.IsDirExists(filepath.Join(specReposDir(), name))
+}
+
+// specRepoAddCmdSlice returns the pod repo add command for the given repo, prefixed with podCmdSlice.
+func specRepoAddCmdSlice(podCmdSlice []string, repo SpecRepo) []string {
+	cmdSlice := append(append([]string{}, podCmdSlice...), "repo", "add", repo.Name, repo.URL)
+	if repo.Revision != "" && !repo.IsCommitRevision() {
+		cmdSlice = append(cmdSlice, repo.Revision)
+	}
+	return cmdSlice
+}
+
+// addSpecRepos adds the spec repos which are not added yet, and checks out the commit revisions.
+func addSpecRepos(repos []SpecRepo, podCmdSlice []string, podfileDir string, podEnvs []string, podLog *PodOutputLog) error {
+	if len(repos) == 0 {
+		return nil
+	}
+
+	fmt.Println()
+	log.Infof("Adding spec repos")
+
+	for _, repo := range repos {
+		added, err := isSpecRepoAdded(repo.Name)
+		if err != nil {
+			return fmt.Errorf("failed to check if spec repo (%s) is added, error: %s", repo.Name, err)
+		}
+		if added {
+			log.Printf("Spec repo (%s) already added", repo.Name)
+			continue
+		}
+
+		cmd, err := rubycommand.NewFromSlice(specRepoAddCmdSlice(podCmdSlice, repo))
+		if err != nil {
+			return fmt.Errorf("failed to create command model, error: %s", err)
+		}
+
+		cmd.SetStdout(podLog.Writer(os.Stdout)).SetStderr(podLog.Writer(os.Stderr))
+		cmd.SetDir(podfileDir)
+		cmd.AppendEnvs(podEnvs...)
+
+		log.Donef("$ %s", redactSecrets(cmd.PrintableCommandArgs()))
+		if err := runCommand(cmd); err != nil {
+			return fmt.Errorf("command failed, error: %s", err)
+		}
+
+		if repo.IsCommitRevision() {
+			cmd = command.New("git", "checkout", repo.Revision)
+			cmd.SetStdout(podLog.Writer(os.Stdout)).SetStderr(podLog.Writer(os.Stderr))
+			cmd.SetDir(filepath.Join(specReposDir(), repo.Name))
+
+			log.Donef("$ %s", redactSecrets(cmd.PrintableCommandArgs()))
+			if err := runCommand(cmd); err != nil {
+				return fmt.Errorf("command failed, error: %s", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+const trunkSpecRepoSource = "trunk"
+
+// specRepoSourcesFromPodfileLockContent returns the sources listed in the SPEC REPOS section of a Podfile.lock:
+//
+//	SPEC REPOS:
+//	  https://github.com/my-org/specs.git:
+//	    - MyPod
+//	  trunk:
+//	    - Alamofire
+func specRepoSourcesFromPodfileLockContent(content string) []string {
+	var sources []string
+	inSection := false
+
+	for _, line := range strings.Split(content, "\n") {
+		if !inSection {
+			if strings.TrimSpace(line) == "SPEC REPOS:" {
+				inSection = true
+			}
+			continue
+		}
+
+		if strings.TrimSpace(line) == "" || !strings.HasPrefix(line, " ") {
+			break
+		}
+
+		// sources are indented by 2, pods by 4 spaces
+		if strings.HasPrefix(line, "    ") {
+			continue
+		}
+
+		source := strings.TrimSuffix(strings.TrimSpace(line), ":")
+		source = strings.Trim(source, `"'`)
+		sources = append(sources, source)
+	}
+
+	return sources
+}
+
+// LocalSpecRepo is a spec repo added to the CocoaPods repos dir.
+type LocalSpecRepo struct {
+	Name  string
+	URL   string
+	IsCDN bool
+}
+
+// listLocalSpecRepos returns the spec repos found in the CocoaPods repos dir.
+func listLocalSpecRepos() ([]LocalSpecRepo, error) {
+	reposDir := specReposDir()
+	if exist, err := pathutil.IsDirExists(reposDir); err != nil {
+		return nil, err
+	} else if !exist {
+		return nil, nil
+	}
+
+	infos, err := ioutil.ReadDir(reposDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var repos []LocalSpecRepo
+	for _, info := range infos {
+		if !info.IsDir() {
+			continue
+		}
+
+		repoDir := filepath.Join(reposDir, info.Name())
+
+		// CDN repos store their url in a .url file
+		cdnURLPth := filepath.Join(repoDir, ".url")
+		if exist, err := pathutil.IsPathExists(cdnURLPth); err != nil {
+			return nil, err
+		} else if exist {
+			url, err := fileutil.ReadStringFromFile(cdnURLPth)
+			if err != nil {
+				return nil, err
+			}
+			repos = append(repos, LocalSpecRepo{Name: info.Name(), URL: strings.TrimSpace(url), IsCDN: true})
+			continue
+		}
+
+		url, err := command.New("git", "config", "--get", "remote.origin.url").SetDir(repoDir).RunAndReturnTrimmedCombinedOutput()
+		if err != nil {
+			log.Warnf("Failed to get the url of spec repo (%s), error: %s", info.Name(), err)
+			continue
+		}
+		repos = append(repos, LocalSpecRepo{Name: info.Name(), URL: url})
+	}
+
+	return repos, nil
+}
+
+func normalizeSpecRepoURL(url string) string {
+	url = strings.ToLower(strings.TrimSpace(url))
+	url = strings.TrimSuffix(url, "/")
+	return strings.TrimSuffix(url, ".git")
+}
+
+func isCDNSpecRepoSource(source string) bool {
+	return source == trunkSpecRepoSource || strings.Contains(source, "cdn.cocoapods.org")
+}
+
+// specReposToUpdate matches the Podfile.lock spec repo sources to the local spec repos,
+// and returns the name of the git spec repos to update. CDN repos are skipped, as they don't need a git pull.
+func specReposToUpdate(sources []string, localRepos []LocalSpecRepo) (names []string, unknownSources []string) {
+	for _, source := range sources {
+		if isCDNSpecRepoSource(source) {
+			continue
+		}
+
+		found := false
+		for _, repo := range localRepos {
+			if normalizeSpecRepoURL(repo.URL) != normalizeSpecRepoURL(source) {
+				continue
+			}
+
+			found = true
+			if !repo.IsCDN {
+				names = append(names, repo.Name)
+			}
+			break
+		}
+
+		if !found {
+			unknownSources = append(unknownSources, source)
+		}
+	}
+
+	return
+}
+
+// specReposToUpdateBeforeRetry returns the name of the git spec repos to update before pod install is retried,
+// or nil if all the repos can be updated by pod repo update.
+// If the Podfile.lock has sources, only their repos are updated. Otherwise the git repos are updated one by one
+// if any repo is pinned or a CDN repo is mirrored: pinned repos must not be updated, and a mirrored CDN repo
+// must not be updated from its original url, the CDN repos are updated by pod install.
+func specReposToUpdateBeforeRetry(sources []string, localRepos []LocalSpecRepo, pins []SpecRepoPin, hasCDNMirrors bool) []string {
+	var names []string
+	if len(sources) > 0 {
+		sourceNames, unknownSources := specReposToUpdate(sources, localRepos)
+		for _, source := range unknownSources {
+			log.Warnf("No spec repo added for source: %s", source)
+		}
+		names = append([]string{}, sourceNames...)
+	} else if len(pins) > 0 || hasCDNMirrors {
+		names = []string{}
+		for _, repo := range localRepos {
+			if !repo.IsCDN {
+				names = append(names, repo.Name)
+			}
+		}
+	}
+
+	if names == nil {
+		return nil
+	}
+
+	for _, pin := range pins {
+		if sliceutil.IsStringInSlice(pin.Name, names) {
+			log.Printf("Spec repo (%s) is pinned to: %s, skipping update", pin.Name, pin.Revision)
+		}
+	}
+	return withoutPinnedSpecRepos(names, pins)
+}
+
+// runSpecRepoUpdate updates the given repos, or all the repos with pod repo update if names is nil.
+func runSpecRepoUpdate(names []string, podCmdSlice []string, dir string, envs []string, jobs int, podLog *PodOutputLog) error {
+	if names == nil {
+		cmd, err := rubycommand.NewFromSlice(append(append([]string{}, podCmdSlice...), "repo", "update"))
+		if err != nil {
+			return fmt.Errorf("failed to create command model, error: %s", err)
+		}
+
+		cmd.SetStdout(podLog.Writer(os.Stdout)).SetStderr(podLog.Writer(os.Stderr))
+		cmd.SetDir(dir)
+		cmd.AppendEnvs(envs...)
+
+		log.Donef("$ %s", redactSecrets(cmd.PrintableCommandArgs()))
+		if err := runCommand(cmd); err != nil {
+			return fmt.Errorf("command failed, error: %s", err)
+		}
+		return nil
+	}
+
+	if len(names) == 0 {
+		log.Printf("No git spec repo to update")
+		return nil
+	}
+	return updateSpecRepos(podCmdSlice, names, dir, envs, jobs)
+}
+
+// updateSpecRepos runs pod repo update for the given repos, using at most jobs concurrent commands.
+func updateSpecRepos(podCmdSlice []string, names []string, dir string, envs []string, jobs int) error {
+	type result struct {
+		name string
+		out  string
+		err  error
+	}
+
+	nameChan := make(chan string)
+	resultChan := make(chan result)
+
+	var wg sync.WaitGroup
+	for i := 0; i < jobs; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for name := range nameChan {
+				cmd, err := rubycommand.NewFromSlice(append(append([]string{}, podCmdSlice...), "repo", "update", name))
+				if err != nil {
+					resultChan <- result{name: name, err: err}
+					continue
+				}
+				cmd.SetDir(dir)
+				cmd.AppendEnvs(envs...)
+
+				var output bytes.Buffer
+				cmd.SetStdout(&output).SetStderr(&output)
+
+				log.Donef("$ %s", redactSecrets(cmd.PrintableCommandArgs()))
+				err = runCommand(cmd)
+				resultChan <- result{name: name, out: strings.TrimSpace(output.String()), err: err}
+			}
+		}()
+	}
+
+	go func() {
+		for _, name := range names {
+			nameChan <- name
+		}
+		close(nameChan)
+	}()
+
+	go func() {
+		wg.Wait()
+		close(resultChan)
+	}()
+
+	var failed []string
+	for res := range resultChan {
+		if res.out != "" {
+			log.Printf("%s", redactSecrets(res.out))
+		}
+		if res.err != nil {
+			log.Errorf("Failed to update spec repo (%s), error: %s", res.name, res.err)
+			failed = append(failed, res.name)
+		} else {
+			log.Donef("Spec repo (%s) updated", res.name)
+		}
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to update spec repos: %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// SpecRepoPin pins a spec repo to a git commit or tag.
+type SpecRepoPin struct {
+	Name     string
+	Revision string
+}
+
+// parseSpecRepoPins parses the spec_repo_revisions input, one pin per line in NAME REVISION format.
+func parseSpecRepoPins(input string) ([]SpecRepoPin, error) {
+	var pins []SpecRepoPin
+	names := map[string]bool{}
+
+	for _, line := range strings.Split(input, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("invalid spec repo revision: %s, expected format: NAME REVISION", line)
+		}
+
+		pin := SpecRepoPin{Name: fields[0], Revision: fields[1]}
+		if names[pin.Name] {
+			return nil, fmt.Errorf("spec repo (%s) pinned multiple times", pin.Name)
+		}
+		names[pin.Name] = true
+
+		pins = append(pins, pin)
+	}
+
+	return pins, nil
+}
+
+func isSpecRepoPinned(name string, pins []SpecRepoPin) bool {
+	for _, pin := range pins {
+		if pin.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// withoutPinnedSpecRepos filters out the pinned repos, as pinned repos must not be updated.
+func withoutPinnedSpecRepos(names []string, pins []SpecRepoPin) []string {
+	filtered := []string{}
+	for _, name := range names {
+		if !isSpecRepoPinned(name, pins) {
+			filtered = append(filtered, name)
+		}
+	}
+	return filtered
+}
+
+// pinSpecRepo checks out the spec repo at the pinned revision and returns a function restoring the original checkout.
+func pinSpecRepo(pin SpecRepoPin, podLog *PodOutputLog) (func() error, error) {
+	repoDir := filepath.Join(specReposDir(), pin.Name)
+	if exist, err := pathutil.IsDirExists(repoDir); err != nil {
+		return nil, err
+	} else if !exist {
+		return nil, fmt.Errorf("spec repo (%s) not found at: %s", pin.Name, repoDir)
+	}
+
+	if exist, err := pathutil.IsPathExists(filepath.Join(repoDir, ".url")); err != nil {
+		return nil, err
+	} else if exist {
+		return nil, fmt.Errorf("spec repo (%s) is a CDN repo, only git spec repos can be pinned", pin.Name)
+	}
+
+	// remember the current branch, or the current commit if the HEAD is detached
+	originalRef, err := command.New("git", "symbolic-ref", "--quiet", "--short", "HEAD").SetDir(repoDir).RunAndReturnTrimmedCombinedOutput()
+	if err != nil {
+		originalRef, err = command.New("git", "rev-parse", "HEAD").SetDir(repoDir).RunAndReturnTrimmedCombinedOutput()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get the current revision of spec repo (%s): %s, error: %s", pin.Name, originalRef, err)
+		}
+	}
+
+	isRevisionAvailable := func() bool {
+		return command.New("git", "rev-parse", "--verify", "--quiet", pin.Revision+"^{commit}").SetDir(repoDir).Run() == nil
+	}
+
+	if !isRevisionAvailable() {
+		cmd := command.New("git", "fetch", "--tags", "origin").SetDir(repoDir).SetStdout(podLog.Writer(os.Stdout)).SetStderr(podLog.Writer(os.Stderr))
+		log.Donef("$ %s", redactSecrets(cmd.PrintableCommandArgs()))
+		if err := runCommand(cmd); err != nil {
+			return nil, fmt.Errorf("failed to fetch spec repo (%s), error: %s", pin.Name, err)
+		}
+
+		if !isRevisionAvailable() {
+			return nil, fmt.Errorf("revision (%s) not found in spec repo (%s)", pin.Revision, pin.Name)
+		}
+	}
+
+	cmd := command.New("git", "checkout", "--quiet", "--detach", pin.Revision).SetDir(repoDir).SetStdout(podLog.Writer(os.Stdout)).SetStderr(podLog.Writer(os.Stderr))
+	log.Donef("$ %s", redactSecrets(cmd.PrintableCommandArgs()))
+	if err := runCommand(cmd); err != nil {
+		return nil, fmt.Errorf("failed to check out revision (%s) of spec repo (%s), error: %s", pin.Revision, pin.Name, err)
+	}
+
+	return func() error {
+		cmd := command.New("git", "checkout", "--quiet", originalRef).SetDir(repoDir).SetStdout(podLog.Writer(os.Stdout)).SetStderr(podLog.Writer(os.Stderr))
+		log.Donef("$ %s", redactSecrets(cmd.PrintableCommandArgs()))
+		return runCleanupCommand(cmd)
+	}, nil
+}
+
+// pinSpecRepos pins the spec repos, and returns a function restoring their original checkouts.
+func pinSpecRepos(pins []SpecRepoPin, podLog *PodOutputLog) (func(), error) {
+	var restoreFuncs []func()
+	restore := func() {
+		for i := len(restoreFuncs) - 1; i >= 0; i-- {
+			restoreFuncs[i]()
+		}
+	}
+	if len(pins) == 0 {
+		return restore, nil
+	}
+
+	fmt.Println()
+	log.Infof("Pinning spec repos")
+
+	for _, pin := range pins {
+		restorePin, err := pinSpecRepo(pin, podLog)
+		if err != nil {
+			restore()
+			return nil, fmt.Errorf("failed to pin spec repo (%s) to revision (%s), error: %s", pin.Name, pin.Revision, err)
+		}
+
+		name := pin.Name
+		restoreFuncs = append(restoreFuncs, func() {
+			if err := restorePin(); err != nil {
+				log.Warnf("Failed to restore spec repo (%s), error: %s", name, err)
+			}
+		})
+
+		log.Donef("Spec repo (%s) pinned to: %s", pin.Name, pin.Revision)
+	}
+
+	return restore, nil
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bitrise-io/go-utils/command"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSpecRepos(t *testing.T) {
+	t.Log("empty input")
+	{
+		repos, err := parseSpecRepos("")
+		require.NoError(t, err)
+		require.Equal(t, 0, len(repos))
+	}
+
+	t.Log("repos with and without revision")
+	{
+		input := `my-specs https://github.com/my-org/my-specs.git
+
+# comment
+other-specs git@github.com:my-org/other-specs.git main
+pinned-specs https://github.com/my-org/pinned-specs.git 0a1b2c3d`
+
+		repos, err := parseSpecRepos(input)
+		require.NoError(t, err)
+		require.Equal(t, []SpecRepo{
+			{Name: "my-specs", URL: "https://github.com/my-org/my-specs.git"},
+			{Name: "other-specs", URL: "git@github.com:my-org/other-specs.git", Revision: "main"},
+			{Name: "pinned-specs", URL: "https://github.com/my-org/pinned-specs.git", Revision: "0a1b2c3d"},
+		}, repos)
+		require.False(t, repos[1].IsCommitRevision())
+		require.True(t, repos[2].IsCommitRevision())
+	}
+
+	t.Log("missing url")
+	{
+		_, err := parseSpecRepos("my-specs")
+		require.Error(t, err)
+	}
+
+	t.Log("duplicated name")
+	{
+		_, err := parseSpecRepos("my-specs https://a.com/specs.git\nmy-specs https://b.com/specs.git")
+		require.Error(t, err)
+	}
+}
+
+func TestSpecRepoAddCmdSlice(t *testing.T) {
+	t.Log("branch")
+	{
+		repo := SpecRepo{Name: "my-specs", URL: "https://github.com/my-org/my-specs.git", Revision: "main"}
+		require.Equal(t, []string{"bundle", "exec", "pod", "repo", "add", "my-specs", "https://github.com/my-org/my-specs.git", "main"}, specRepoAddCmdSlice([]string{"bundle", "exec", "pod"}, repo))
+	}
+
+	t.Log("commit")
+	{
+		repo := SpecRepo{Name: "my-specs", URL: "https://github.com/my-org/my-specs.git", Revision: "0a1b2c3d"}
+		require.Equal(t, []string{"pod", "repo", "add", "my-specs", "https://github.com/my-org/my-specs.git"}, specRepoAddCmdSlice([]string{"pod"}, repo))
+	}
+}
+
+func TestAddSpecRepos(t *testing.T) {
+	reposDir, err := ioutil.TempDir("", "repos")
+	require.NoError(t, err)
+	defer func() { require.NoError(t, os.RemoveAll(reposDir)) }()
+
+	original, isSet := os.LookupEnv("CP_REPOS_DIR")
+	require.NoError(t, os.Setenv("CP_REPOS_DIR", reposDir))
+	defer func() {
+		if isSet {
+			require.NoError(t, os.Setenv("CP_REPOS_DIR", original))
+		} else {
+			require.NoError(t, os.Unsetenv("CP_REPOS_DIR"))
+		}
+	}()
+
+	podLog, err := NewPodOutputLog("")
+	require.NoError(t, err)
+
+	t.Log("no spec repos")
+	{
+		require.NoError(t, addSpecRepos(nil, []string{"pod"}, reposDir, nil, podLog))
+	}
+
+	t.Log("skips the added spec repos")
+	{
+		require.NoError(t, os.MkdirAll(filepath.Join(reposDir, "my-specs"), 0755))
+		repos := []SpecRepo{{Name: "my-specs", URL: "https://github.com/my-org/my-specs.git", Revision: "0a1b2c3d"}}
+		require.NoError(t, addSpecRepos(repos, []string{"pod"}, reposDir, nil, podLog))
+		require.Equal(t, "", podLog.String())
+	}
+}
+
+func TestSpecRepoSourcesFromPodfileLockContent(t *testing.T) {
+	t.Log("Podfile.lock with spec repos")
+	{
+		content := `PODS:
+  - Alamofire (5.4.3)
+  - MyPod (1.0.0)
+
+DEPENDENCIES:
+  - Alamofire
+  - MyPod
+
+SPEC REPOS:
+  https://github.com/my-org/specs.git:
+    - MyPod
+  trunk:
+    - Alamofire
+
+SPEC CHECKSUMS:
+  Alamofire: e447a2774a40c996748296fa2c55112fdbbc42f9
+
+COCOAPODS: 1.10.1
+`
+
+		require.Equal(t, []string{"https://github.com/my-org/specs.git", "trunk"}, specRepoSourcesFromPodfileLockContent(content))
+	}
+
+	t.Log("Podfile.lock without spec repos")
+	{
+		content := `PODS:
+  - Alamofire (3.4.0)
+
+COCOAPODS: 1.0.0
+`
+
+		require.Equal(t, 0, len(specRepoSourcesFromPodfileLockContent(content)))
+	}
+}
+
+func TestSpecReposToUpdate(t *testing.T) {
+	localRepos := []LocalSpecRepo{
+		{Name: "trunk", URL: "https://cdn.cocoapods.org/", IsCDN: true},
+		{Name: "my-org", URL: "https://github.com/my-org/specs"},
+		{Name: "other", URL: "git@github.com:my-org/other-specs.git"},
+		{Name: "mirror", URL: "https://pods-mirror.internal/", IsCDN: true},
+	}
+
+	sources := []string{
+		"https://github.com/my-org/specs.git",
+		"trunk",
+		"https://pods-mirror.internal",
+		"git@github.com:my-org/unknown.git",
+	}
+
+	names, unknownSources := specReposToUpdate(sources, localRepos)
+	require.Equal(t, []string{"my-org"}, names)
+	require.Equal(t, []string{"git@github.com:my-org/unknown.git"}, unknownSources)
+}
+
+func TestSpecReposToUpdateBeforeRetry(t *testing.T) {
+	localRepos := []LocalSpecRepo{
+		{Name: "trunk", URL: "https://cdn.cocoapods.org/", IsCDN: true},
+		{Name: "my-specs", URL: "https://github.com/my-org/specs.git"},
+		{Name: "other-specs", URL: "https://github.com/my-org/other-specs.git"},
+	}
+	pins := []SpecRepoPin{{Name: "other-specs", Revision: "v1.0.0"}}
+
+	t.Log("the repos of the Podfile.lock sources")
+	{
+		require.Equal(t, []string{"my-specs"}, specReposToUpdateBeforeRetry([]string{"https://github.com/my-org/specs.git", "trunk"}, localRepos, nil, false))
+		require.Equal(t, []string{}, specReposToUpdateBeforeRetry([]string{"https://github.com/my-org/other-specs.git"}, localRepos, pins, false))
+	}
+
+	t.Log("all the repos without Podfile.lock sources")
+	{
+		require.Nil(t, specReposToUpdateBeforeRetry(nil, localRepos, nil, false))
+	}
+
+	t.Log("the unpinned git repos with pins or CDN mirrors")
+	{
+		require.Equal(t, []string{"my-specs"}, specReposToUpdateBeforeRetry(nil, localRepos, pins, false))
+		require.Equal(t, []string{"my-specs", "other-specs"}, specReposToUpdateBeforeRetry(nil, localRepos, nil, true))
+	}
+}
+
+func TestParseSpecRepoPins(t *testing.T) {
+	t.Log("valid pins")
+	{
+		pins, err := parseSpecRepoPins("my-specs 0a1b2c3d\n\nother-specs v1.2.0\n")
+		require.NoError(t, err)
+		require.Equal(t, []SpecRepoPin{
+			{Name: "my-specs", Revision: "0a1b2c3d"},
+			{Name: "other-specs", Revision: "v1.2.0"},
+		}, pins)
+		require.Equal(t, []string{"third-specs"}, withoutPinnedSpecRepos([]string{"my-specs", "third-specs"}, pins))
+	}
+
+	t.Log("missing revision")
+	{
+		_, err := parseSpecRepoPins("my-specs")
+		require.Error(t, err)
+	}
+
+	t.Log("duplicated name")
+	{
+		_, err := parseSpecRepoPins("my-specs v1\nmy-specs v2")
+		require.Error(t, err)
+	}
+}
+
+func TestPinSpecRepos(t *testing.T) {
+	reposDir, err := ioutil.TempDir("", "repos")
+	require.NoError(t, err)
+	defer func() { require.NoError(t, os.RemoveAll(reposDir)) }()
+
+	original, isSet := os.LookupEnv("CP_REPOS_DIR")
+	require.NoError(t, os.Setenv("CP_REPOS_DIR", reposDir))
+	defer func() {
+		if isSet {
+			require.NoError(t, os.Setenv("CP_REPOS_DIR", original))
+		} else {
+			require.NoError(t, os.Unsetenv("CP_REPOS_DIR"))
+		}
+	}()
+
+	repoDir := filepath.Join(reposDir, "my-specs")
+	require.NoError(t, os.MkdirAll(repoDir, 0755))
+	git := func(args ...string) string {
+		out, err := command.New("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...).SetDir(repoDir).RunAndReturnTrimmedCombinedOutput()
+		require.NoError(t, err, out)
+		return out
+	}
+	git("init", "--quiet", "--initial-branch", "master")
+	git("commit", "--quiet", "--allow-empty", "-m", "first")
+	first := git("rev-parse", "HEAD")
+	git("commit", "--quiet", "--allow-empty", "-m", "second")
+
+	podLog, err := NewPodOutputLog("")
+	require.NoError(t, err)
+
+	t.Log("pins and restores the checkout")
+	{
+		restore, err := pinSpecRepos([]SpecRepoPin{{Name: "my-specs", Revision: first}}, podLog)
+		require.NoError(t, err)
+		require.Equal(t, first, git("rev-parse", "HEAD"))
+
+		restore()
+		require.Equal(t, "master", git("symbolic-ref", "--short", "HEAD"))
+	}
+
+	t.Log("restores the pinned repos if a pin fails")
+	{
+		_, err := pinSpecRepos([]SpecRepoPin{{Name: "my-specs", Revision: first}, {Name: "missing-specs", Revision: first}}, podLog)
+		require.Error(t, err)
+		require.Equal(t, "master", git("symbolic-ref", "--short", "HEAD"))
+	}
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bitrise-io/go-steputils/tools"
+	"github.com/bitrise-io/go-utils/fileutil"
+	"github.com/bitrise-io/go-utils/log"
+)
+
+const podInstallTimingSlowestCount = 10
+
+// podInstallPhaseNames are the top level progress lines CocoaPods prints, both in normal and verbose mode.
+var podInstallPhaseNames = []string{
+	"Updating local specs repositories",
+	"Analyzing dependencies",
+	"Downloading dependencies",
+	"Generating Pods project",
+	"Integrating client project",
+}
+
+// Installing Alamofire (5.4.3)
+// -> Installing Alamofire (5.4.3)
+// Installing Alamofire 5.4.3 (was 5.4.2)
+// Using Alamofire (5.4.3)
+var podProgressExp = regexp.MustCompile(`^(?:-> )?(Installing|Using) (\S+) \(?([^\s)]+)`)
+
+// PodInstallPhase is a timed stage of pod install.
+type PodInstallPhase struct {
+	Name     string  `json:"name"`
+	Duration float64 `json:"duration_seconds"`
+
+	start time.Time
+}
+
+// PodDownload is the time spent on installing a single pod.
+type PodDownload struct {
+	Pod      string  `json:"pod"`
+	Version  string  `json:"version"`
+	Duration float64 `json:"duration_seconds"`
+
+	start time.Time
+}
+
+// PodInstallTiming is the timing report of a pod install.
+type PodInstallTiming struct {
+	Phases         []PodInstallPhase `json:"phases"`
+	SlowestPods    []PodDownload     `json:"slowest_pods"`
+	TotalDuration  float64           `json:"total_duration_seconds"`
+	InstalledCount int               `json:"installed_pod_count"`
+}
+
+// PodInstallTimer is a writer, which times the pod install phases and pod installs based on the pod install output.
+type PodInstallTimer struct {
+	mu      sync.Mutex
+	partial string
+	start   time.Time
+
+	phases []PodInstallPhase
+	pods   []PodDownload
+
+	currentPhase *PodInstallPhase
+	currentPod   *PodDownload
+	finished     bool
+}
+
+// NewPodInstallTimer ...
+func NewPodInstallTimer() *PodInstallTimer {
+	return &PodInstallTimer{start: time.Now()}
+}
+
+// Write ...
+func (t *PodInstallTimer) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	content := t.partial + string(p)
+	lines := strings.Split(content, "\n")
+	t.partial = lines[len(lines)-1]
+
+	for _, line := range lines[:len(lines)-1] {
+		t.observeLine(line, now)
+	}
+
+	return len(p), nil
+}
+
+func (t *PodInstallTimer) finishPod(at time.Time) {
+	if t.currentPod == nil {
+		return
+	}
+	t.currentPod.Duration = at.Sub(t.currentPod.start).Seconds()
+	t.pods = append(t.pods, *t.currentPod)
+	t.currentPod = nil
+}
+
+func (t *PodInstallTimer) finishPhase(at time.Time) {
+	t.finishPod(at)
+	if t.currentPhase == nil {
+		return
+	}
+	t.currentPhase.Duration = at.Sub(t.currentPhase.start).Seconds()
+	t.phases = append(t.phases, *t.currentPhase)
+	t.currentPhase = nil
+}
+
+func (t *PodInstallTimer) observeLine(line string, at time.Time) {
+	if t.finished {
+		return
+	}
+
+	line = strings.TrimSpace(ansiEscapeExp.ReplaceAllString(line, ""))
+
+	for _, name := range podInstallPhaseNames {
+		if strings.HasPrefix(line, name) {
+			t.finishPhase(at)
+			t.currentPhase = &PodInstallPhase{Name: name, start: at}
+			return
+		}
+	}
+
+	if strings.HasPrefix(line, "Pod installation complete!") {
+		t.finishPhase(at)
+		t.finished = true
+		return
+	}
+
+	if t.currentPhase != nil && t.currentPhase.Name != "Downloading dependencies" {
+		return
+	}
+
+	if match := podProgressExp.FindStringSubmatch(line); match != nil {
+		t.finishPod(at)
+		if match[1] == "Installing" {
+			t.currentPod = &PodDownload{Pod: match[2], Version: match[3], start: at}
+		}
+	}
+}
+
+// Report closes the running phase and returns the phases and the slowest pod installs.
+func (t *PodInstallTimer) Report(slowestCount int) PodInstallTiming {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.report(time.Now(), slowestCount)
+}
+
+func (t *PodInstallTimer) report(at time.Time, slowestCount int) PodInstallTiming {
+	t.finishPhase(at)
+
+	pods := append([]PodDownload{}, t.pods...)
+	sort.SliceStable(pods, func(i, j int) bool {
+		return pods[i].Duration > pods[j].Duration
+	})
+	installedCount := len(pods)
+	if len(pods) > slowestCount {
+		pods = pods[:slowestCount]
+	}
+
+	return PodInstallTiming{
+		Phases:         append([]PodInstallPhase{}, t.phases...),
+		SlowestPods:    pods,
+		TotalDuration:  at.Sub(t.start).Seconds(),
+		InstalledCount: installedCount,
+	}
+}
+
+// printAndExportPodInstallTiming prints the timing report and writes it as JSON to the deploy dir.
+func printAndExportPodInstallTiming(timing PodInstallTiming, deployDir string) {
+	fmt.Println()
+	log.Infof("Pod install timing:")
+
+	for _, phase := range timing.Phases {
+		log.Printf("- %s: %.1fs", phase.Name, phase.Duration)
+	}
+	log.Printf("Total: %.1fs", timing.TotalDuration)
+
+	if len(timing.SlowestPods) > 0 {
+		log.Printf("Slowest pod installs (of %d):", timing.InstalledCount)
+		for _, pod := range timing.SlowestPods {
+			log.Printf("- %s (%s): %.1fs", pod.Pod, pod.Version, pod.Duration)
+		}
+	}
+
+	if deployDir == "" {
+		return
+	}
+
+	content, err := json.MarshalIndent(timing, "", "  ")
+	if err != nil {
+		log.Warnf("Failed to serialize pod install timing, error: %s", err)
+		return
+	}
+
+	pth := filepath.Join(deployDir, "pod_install_timing.json")
+	if err := fileutil.WriteBytesToFile(pth, content); err != nil {
+		log.Warnf("Failed to write pod install timing, error: %s", err)
+		return
+	}
+
+	if err := tools.ExportEnvironmentWithEnvman("COCOAPODS_TIMING_PATH", pth); err != nil {
+		log.Warnf("Failed to export COCOAPODS_TIMING_PATH, error: %s", err)
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPodInstallTimer(t *testing.T) {
+	start := time.Date(2021, 5, 1, 10, 0, 0, 0, time.UTC)
+	timer := &PodInstallTimer{start: start}
+
+	output := []struct {
+		line   string
+		offset time.Duration
+	}{
+		{"Analyzing dependencies", 0},
+		{"Downloading dependencies", 20 * time.Second},
+		{"Installing Alamofire (5.4.3)", 20 * time.Second},
+		{"Using Kingfisher (6.3.0)", 50 * time.Second},
+		{"-> Installing Firebase (8.0.0)", 51 * time.Second},
+		{"Generating Pods project", 61 * time.Second},
+		{"  - Installing target `Alamofire` iOS 10.0", 62 * time.Second},
+		{"Integrating client project", 70 * time.Second},
+		{"Pod installation complete! There are 3 dependencies from the Podfile and 3 total pods installed.", 75 * time.Second},
+		{"[!] Some warning", 80 * time.Second},
+	}
+	for _, o := range output {
+		timer.observeLine(o.line, start.Add(o.offset))
+	}
+
+	timing := timer.report(start.Add(80*time.Second), 1)
+	require.Equal(t, []PodInstallPhase{
+		{Name: "Analyzing dependencies", Duration: 20, start: start},
+		{Name: "Downloading dependencies", Duration: 41, start: start.Add(20 * time.Second)},
+		{Name: "Generating Pods project", Duration: 9, start: start.Add(61 * time.Second)},
+		{Name: "Integrating client project", Duration: 5, start: start.Add(70 * time.Second)},
+	}, timing.Phases)
+	require.Equal(t, []PodDownload{{Pod: "Alamofire", Version: "5.4.3", Duration: 30, start: start.Add(20 * time.Second)}}, timing.SlowestPods)
+	require.Equal(t, 2, timing.InstalledCount)
+	require.Equal(t, 80.0, timing.TotalDuration)
+}
+
+func TestPodInstallTimerWrite(t *testing.T) {
+	timer := NewPodInstallTimer()
+
+	for _, chunk := range []string{"Analyzing depend", "encies\nDownloading dependencies\nInstalling Ala", "mofire (5.4.3)\n"} {
+		n, err := timer.Write([]byte(chunk))
+		require.NoError(t, err)
+		require.Equal(t, len(chunk), n)
+	}
+
+	timing := timer.Report(10)
+	var phases []string
+	for _, phase := range timing.Phases {
+		phases = append(phases, phase.Name)
+	}
+	require.Equal(t, "Analyzing dependencies, Downloading dependencies", strings.Join(phases, ", "))
+	require.Equal(t, 1, timing.InstalledCount)
+}
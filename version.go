@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	versionExp        = regexp.MustCompile(`^[0-9]+(\.[0-9A-Za-z]+)*$`)
+	versionSegmentExp = regexp.MustCompile(`[0-9]+|[A-Za-z]+`)
+)
+
+// versionPart is a numeric or a string (prerelease) segment of a version.
+type versionPart struct {
+	number   int
+	str      string
+	isString bool
+}
+
+// versionParts splits the version into numeric and string parts the way RubyGems does, 1.12.0.beta1 is [1 12 0 beta 1].
+func versionParts(version string) ([]versionPart, error) {
+	if !versionExp.MatchString(version) {
+		return nil, fmt.Errorf("invalid version: %s", version)
+	}
+
+	var parts []versionPart
+	for _, segment := range versionSegmentExp.FindAllString(version, -1) {
+		number, err := strconv.Atoi(segment)
+		if err != nil {
+			parts = append(parts, versionPart{str: segment, isString: true})
+		} else {
+			parts = append(parts, versionPart{number: number})
+		}
+	}
+	return parts, nil
+}
+
+// isValidVersion returns true if the version is a dot separated version, like 12.0 or 1.12.0.beta.1.
+func isValidVersion(version string) bool {
+	return versionExp.MatchString(version)
+}
+
+// isPrereleaseVersion returns true if the version contains a letter, like 1.12.0.beta.1 or 1.11.0.rc.1.
+func isPrereleaseVersion(version string) bool {
+	return strings.IndexFunc(version, func(r rune) bool {
+		return (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z')
+	}) != -1
+}
+
+// releaseVersion returns the numeric segments of the version preceding the prerelease segments, 1.12.0.beta.1 is 1.12.0.
+func releaseVersion(version string) string {
+	var segments []string
+	for _, segment := range strings.Split(version, ".") {
+		if isPrereleaseVersion(segment) {
+			break
+		}
+		segments = append(segments, segment)
+	}
+	return strings.Join(segments, ".")
+}
+
+// compareVersions compares two dot separated versions with RubyGems semantics, returns -1, 0 or 1.
+// Missing segments are considered to be 0, so 1.10 equals to 1.10.0,
+// and a prerelease is lower than the release: 1.12.0.beta.1 < 1.12.0.rc.1 < 1.12.0.
+func compareVersions(a, b string) (int, error) {
+	aParts, err := versionParts(a)
+	if err != nil {
+		return 0, err
+	}
+	bParts, err := versionParts(b)
+	if err != nil {
+		return 0, err
+	}
+
+	for i := 0; i < len(aParts) || i < len(bParts); i++ {
+		aPart, bPart := versionPart{}, versionPart{}
+		if i < len(aParts) {
+			aPart = aParts[i]
+		}
+		if i < len(bParts) {
+			bPart = bParts[i]
+		}
+
+		if cmp := compareVersionParts(aPart, bPart); cmp != 0 {
+			return cmp, nil
+		}
+	}
+
+	return 0, nil
+}
+
+func compareVersionParts(a, b versionPart) int {
+	switch {
+	case a.isString && b.isString:
+		return strings.Compare(a.str, b.str)
+	case a.isString:
+		return -1
+	case b.isString:
+		return 1
+	case a.number < b.number:
+		return -1
+	case a.number > b.number:
+		return 1
+	}
+	return 0
+}
+
+func versionSegment(segments []string, i int) (int, error) {
+	if i >= len(segments) {
+		return 0, nil
+	}
+	return strconv.Atoi(segments[i])
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompareVersions(t *testing.T) {
+	for _, tc := range []struct {
+		a, b string
+		want int
+	}{
+		{"1.10.1", "1.10.1", 0},
+		{"1.10", "1.10.0", 0},
+		{"1.9.3", "1.10.0", -1},
+		{"1.11.0", "1.10.2", 1},
+		{"2", "1.99.99", 1},
+		{"1.12.0.beta.1", "1.12.0", -1},
+		{"1.12.0.beta.1", "1.11.3", 1},
+		{"1.12.0.beta.1", "1.12.0.beta.2", -1},
+		{"1.12.0.beta.2", "1.12.0.rc.1", -1},
+		{"1.12.0.beta1", "1.12.0.beta.1", 0},
+		{"1.11.0.rc.1", "1.11.0.rc.1", 0},
+	} {
+		got, err := compareVersions(tc.a, tc.b)
+		require.NoError(t, err)
+		require.Equal(t, tc.want, got, "%s <=> %s", tc.a, tc.b)
+	}
+
+	_, err := compareVersions("1..0", "1.0")
+	require.Error(t, err)
+}
+
+func TestIsValidVersion(t *testing.T) {
+	require.True(t, isValidVersion("12.0"))
+	require.True(t, isValidVersion("1.12.0.beta.1"))
+	require.False(t, isValidVersion(""))
+	require.False(t, isValidVersion("latest"))
+	require.False(t, isValidVersion("$(RECOMMENDED_IPHONEOS_DEPLOYMENT_TARGET)"))
+}
+
+func TestIsPrereleaseVersion(t *testing.T) {
+	require.True(t, isPrereleaseVersion("1.12.0.beta.1"))
+	require.True(t, isPrereleaseVersion("1.11.0.rc.1"))
+	require.False(t, isPrereleaseVersion("1.11.0"))
+}
+
+func TestReleaseVersion(t *testing.T) {
+	require.Equal(t, "1.12.0", releaseVersion("1.12.0.beta.1"))
+	require.Equal(t, "1.11", releaseVersion("1.11.rc1"))
+	require.Equal(t, "1.11.3", releaseVersion("1.11.3"))
+}
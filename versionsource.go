@@ -0,0 +1,167 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/bitrise-io/go-steputils/tools"
+	"github.com/bitrise-io/go-utils/command"
+	"github.com/bitrise-io/go-utils/log"
+)
+
+// VersionSourcePolicy is which file or input decides the CocoaPods version.
+type VersionSourcePolicy string
+
+// VersionSourcePolicies ...
+const (
+	VersionSourcePolicyGemfile        VersionSourcePolicy = "gemfile"
+	VersionSourcePolicyPodfileLock    VersionSourcePolicy = "podfile_lock"
+	VersionSourcePolicyExplicit       VersionSourcePolicy = "explicit"
+	VersionSourcePolicyFailOnMismatch VersionSourcePolicy = "fail_on_mismatch"
+)
+
+// VersionFallback is what to do if the chosen CocoaPods version can not be installed.
+type VersionFallback string
+
+// VersionFallbacks ...
+const (
+	VersionFallbackNearestPatch VersionFallback = "nearest_patch"
+	VersionFallbackNone         VersionFallback = "none"
+)
+
+// CocoaPods version sources
+const (
+	CocoapodsVersionSourceGemfileLock = "Gemfile.lock"
+	CocoapodsVersionSourcePodfileLock = "Podfile.lock"
+	CocoapodsVersionSourceInput       = "cocoapods_version input"
+	CocoapodsVersionSourceSystem      = "system"
+)
+
+// CocoapodsVersionDecision is the CocoaPods version to use, where it comes from and why.
+type CocoapodsVersionDecision struct {
+	// Version is the exact version to install, or the Gemfile.lock requirement if UseBundler is set.
+	Version    string
+	Source     string
+	UseBundler bool
+	Reason     string
+}
+
+// decideCocoapodsVersion chooses the CocoaPods version based on the policy, the Podfile.lock version,
+// the Gemfile.lock version (empty if Gemfile.lock does not contain cocoapods) and the explicit version.
+func decideCocoapodsVersion(policy VersionSourcePolicy, podfileLockVersion, gemfileLockVersion, explicitVersion string) (CocoapodsVersionDecision, error) {
+	if policy == VersionSourcePolicyExplicit {
+		if explicitVersion == "" {
+			return CocoapodsVersionDecision{}, fmt.Errorf("version source is %s, but no cocoapods_version specified", policy)
+		}
+
+		reason := "version source is explicit"
+		if podfileLockVersion != "" && podfileLockVersion != explicitVersion {
+			reason += fmt.Sprintf(", overriding Podfile.lock (%s)", podfileLockVersion)
+		}
+		return CocoapodsVersionDecision{Version: explicitVersion, Source: CocoapodsVersionSourceInput, Reason: reason}, nil
+	}
+
+	if policy == VersionSourcePolicyPodfileLock && podfileLockVersion != "" {
+		reason := "version source is podfile_lock"
+		if gemfileLockVersion != "" {
+			reason += fmt.Sprintf(", ignoring Gemfile.lock (%s)", gemfileLockVersion)
+		}
+		return CocoapodsVersionDecision{Version: podfileLockVersion, Source: CocoapodsVersionSourcePodfileLock, Reason: reason}, nil
+	}
+
+	if gemfileLockVersion != "" {
+		reason := "Gemfile.lock contains cocoapods"
+		if policy == VersionSourcePolicyPodfileLock {
+			reason = "version source is podfile_lock, but Podfile.lock has no CocoaPods version, and Gemfile.lock contains cocoapods"
+		}
+
+		if podfileLockVersion != "" {
+			satisfied, err := isGemRequirementSatisfied(podfileLockVersion, gemfileLockVersion)
+			if err != nil {
+				return CocoapodsVersionDecision{}, fmt.Errorf("failed to compare Podfile.lock version (%s) with Gemfile.lock version (%s), error: %s", podfileLockVersion, gemfileLockVersion, err)
+			}
+
+			if !satisfied {
+				if policy == VersionSourcePolicyFailOnMismatch {
+					return CocoapodsVersionDecision{}, fmt.Errorf("CocoaPods version in Podfile.lock (%s) does not satisfy Gemfile.lock (%s)", podfileLockVersion, gemfileLockVersion)
+				}
+				reason += fmt.Sprintf(", Podfile.lock (%s) does not satisfy it", podfileLockVersion)
+			}
+		}
+
+		return CocoapodsVersionDecision{Version: gemfileLockVersion, Source: CocoapodsVersionSourceGemfileLock, UseBundler: true, Reason: reason}, nil
+	}
+
+	if podfileLockVersion != "" {
+		return CocoapodsVersionDecision{Version: podfileLockVersion, Source: CocoapodsVersionSourcePodfileLock, Reason: "no Gemfile.lock with cocoapods found"}, nil
+	}
+
+	return CocoapodsVersionDecision{Source: CocoapodsVersionSourceSystem, Reason: "no CocoaPods version found in Podfile.lock or Gemfile.lock"}, nil
+}
+
+// nearestPatchVersion returns the available release of the same major and minor version whose patch version is the closest to the version's,
+// preferring the newer one on a tie. Returns an empty string if there is no such release.
+// A prerelease has no fallback, as it is pinned on purpose.
+func nearestPatchVersion(version string, available []string) string {
+	segments := strings.Split(version, ".")
+	if len(segments) < 3 || isPrereleaseVersion(version) {
+		return ""
+	}
+	patch, err := versionSegment(segments, 2)
+	if err != nil {
+		return ""
+	}
+	minorPrefix := strings.Join(segments[:2], ".") + "."
+
+	nearest, nearestDistance, nearestPatch := "", -1, -1
+	for _, candidate := range available {
+		candidateSegments := strings.Split(candidate, ".")
+		if candidate == version || len(candidateSegments) != 3 || !strings.HasPrefix(candidate, minorPrefix) {
+			continue
+		}
+		candidatePatch, err := versionSegment(candidateSegments, 2)
+		if err != nil {
+			continue
+		}
+
+		distance := candidatePatch - patch
+		if distance < 0 {
+			distance = -distance
+		}
+
+		if nearestDistance == -1 || distance < nearestDistance || (distance == nearestDistance && candidatePatch > nearestPatch) {
+			nearest, nearestDistance, nearestPatch = candidate, distance, candidatePatch
+		}
+	}
+
+	return nearest
+}
+
+// remoteGemVersions lists the versions of the gem available on the gem source.
+func remoteGemVersions(gem string, source GemSource) ([]string, error) {
+	sourceArgs, err := gemSourceArgs(source)
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := command.New("gem", append([]string{"list", "--remote", "--exact", "--all", gem}, sourceArgs...)...)
+	out, err := cmd.RunAndReturnTrimmedCombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", redactSecrets(out), err)
+	}
+
+	return parseGemListVersions(out, gem), nil
+}
+
+// exportCocoapodsVersionDecision exports the chosen CocoaPods version, where it comes from and why.
+func exportCocoapodsVersionDecision(decision CocoapodsVersionDecision) {
+	for key, value := range map[string]string{
+		"COCOAPODS_VERSION":        decision.Version,
+		"COCOAPODS_VERSION_SOURCE": decision.Source,
+		"COCOAPODS_VERSION_REASON": decision.Reason,
+	} {
+		if err := tools.ExportEnvironmentWithEnvman(key, value); err != nil {
+			log.Warnf("Failed to export %s, error: %s", key, err)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecideCocoapodsVersion(t *testing.T) {
+	t.Log("gemfile: bundler if Gemfile.lock contains cocoapods")
+	{
+		decision, err := decideCocoapodsVersion(VersionSourcePolicyGemfile, "1.10.1", "1.10.1", "")
+		require.NoError(t, err)
+		require.Equal(t, "1.10.1", decision.Version)
+		require.Equal(t, CocoapodsVersionSourceGemfileLock, decision.Source)
+		require.True(t, decision.UseBundler)
+	}
+
+	t.Log("gemfile: mismatch is explained")
+	{
+		decision, err := decideCocoapodsVersion(VersionSourcePolicyGemfile, "1.9.3", "1.10.1", "")
+		require.NoError(t, err)
+		require.True(t, decision.UseBundler)
+		require.Contains(t, decision.Reason, "Podfile.lock (1.9.3) does not satisfy it")
+	}
+
+	t.Log("gemfile: Podfile.lock without Gemfile.lock")
+	{
+		decision, err := decideCocoapodsVersion(VersionSourcePolicyGemfile, "1.10.1", "", "")
+		require.NoError(t, err)
+		require.Equal(t, CocoapodsVersionDecision{Version: "1.10.1", Source: CocoapodsVersionSourcePodfileLock, Reason: "no Gemfile.lock with cocoapods found"}, decision)
+	}
+
+	t.Log("gemfile: no version found")
+	{
+		decision, err := decideCocoapodsVersion(VersionSourcePolicyGemfile, "", "", "")
+		require.NoError(t, err)
+		require.Equal(t, "", decision.Version)
+		require.Equal(t, CocoapodsVersionSourceSystem, decision.Source)
+	}
+
+	t.Log("gemfile: prerelease Podfile.lock version")
+	{
+		decision, err := decideCocoapodsVersion(VersionSourcePolicyGemfile, "1.12.0.rc.1", ">= 1.11", "")
+		require.NoError(t, err)
+		require.Equal(t, CocoapodsVersionDecision{Version: ">= 1.11", Source: CocoapodsVersionSourceGemfileLock, UseBundler: true, Reason: "Gemfile.lock contains cocoapods"}, decision)
+
+		decision, err = decideCocoapodsVersion(VersionSourcePolicyGemfile, "1.11.3", "~> 1.12.0.beta", "")
+		require.NoError(t, err)
+		require.Contains(t, decision.Reason, "Podfile.lock (1.11.3) does not satisfy it")
+
+		_, err = decideCocoapodsVersion(VersionSourcePolicyFailOnMismatch, "1.12.0.beta.2", "~> 1.12.0.beta", "")
+		require.NoError(t, err)
+	}
+
+	t.Log("fail_on_mismatch")
+	{
+		_, err := decideCocoapodsVersion(VersionSourcePolicyFailOnMismatch, "1.9.3", "1.10.1", "")
+		require.Error(t, err)
+
+		decision, err := decideCocoapodsVersion(VersionSourcePolicyFailOnMismatch, "1.10.1", "~> 1.10", "")
+		require.NoError(t, err)
+		require.True(t, decision.UseBundler)
+	}
+
+	t.Log("podfile_lock")
+	{
+		decision, err := decideCocoapodsVersion(VersionSourcePolicyPodfileLock, "1.9.3", "1.10.1", "")
+		require.NoError(t, err)
+		require.Equal(t, "1.9.3", decision.Version)
+		require.Equal(t, CocoapodsVersionSourcePodfileLock, decision.Source)
+		require.False(t, decision.UseBundler)
+
+		decision, err = decideCocoapodsVersion(VersionSourcePolicyPodfileLock, "", "1.10.1", "")
+		require.NoError(t, err)
+		require.True(t, decision.UseBundler)
+	}
+
+	t.Log("explicit")
+	{
+		decision, err := decideCocoapodsVersion(VersionSourcePolicyExplicit, "1.9.3", "1.10.1", "1.11.3")
+		require.NoError(t, err)
+		require.Equal(t, "1.11.3", decision.Version)
+		require.Equal(t, CocoapodsVersionSourceInput, decision.Source)
+		require.False(t, decision.UseBundler)
+		require.Contains(t, decision.Reason, "overriding Podfile.lock (1.9.3)")
+
+		_, err = decideCocoapodsVersion(VersionSourcePolicyExplicit, "1.9.3", "", "")
+		require.Error(t, err)
+	}
+}
+
+func TestNearestPatchVersion(t *testing.T) {
+	available := []string{"1.11.3", "1.11.2", "1.11.0", "1.10.2", "1.10.0", "1.10.0.rc.1", "1.9.3"}
+
+	require.Equal(t, "1.11.2", nearestPatchVersion("1.11.1", available))
+	require.Equal(t, "1.10.2", nearestPatchVersion("1.10.1", available))
+	require.Equal(t, "1.11.3", nearestPatchVersion("1.11.4", available))
+	require.Equal(t, "", nearestPatchVersion("1.9.3", available))
+	require.Equal(t, "", nearestPatchVersion("1.8.4", available))
+	require.Equal(t, "", nearestPatchVersion("1.11", available))
+	require.Equal(t, "", nearestPatchVersion("1.10.0.beta.1", available))
+}